@@ -0,0 +1,150 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const API_TOKEN_PREFIX = "oj_"
+const apiTokenScopesKey = "apiTokenScopes"
+
+// api token scopes, a token can never do more than its user
+const SCOPE_SUBMISSIONS_READ = "submissions:read"
+const SCOPE_SUBMISSIONS_WRITE = "submissions:write"
+
+// problem editing and every other admin route
+const SCOPE_PROBLEMS_ADMIN = "problems:admin"
+
+var apiTokenScopes = []string{SCOPE_SUBMISSIONS_READ, SCOPE_SUBMISSIONS_WRITE, SCOPE_PROBLEMS_ADMIN}
+
+type ApiToken struct {
+	Id         string     `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+}
+
+// only the SHA-256 of a token is stored, the token itself is shown once on creation
+type ApiTokenTable struct {
+	Id        int    `gorm:"auto_increment;primary_key;" json:"apiTokenId"`
+	Name      string `gorm:"size:255;not null" json:"name"`
+	TokenHash string `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	// comma separated
+	Scopes     string     `gorm:"size:255;not null" json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+
+	UserId int `gorm:"index" json:"userId"`
+}
+
+type ApiTokenPostDTO struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func isValidApiTokenScope(scope string) bool {
+	for _, s := range apiTokenScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func newApiToken(token ApiTokenTable) ApiToken {
+	return ApiToken{
+		Id:         strconv.Itoa(token.Id),
+		Name:       token.Name,
+		Scopes:     strings.Split(token.Scopes, ","),
+		CreatedAt:  token.CreatedAt,
+		ExpiresAt:  token.ExpiresAt,
+		LastUsedAt: token.LastUsedAt,
+	}
+}
+
+// requests authenticated by an api token instead of a session
+func isApiTokenRequest(c *gin.Context) bool {
+	_, ok := c.Get(apiTokenScopesKey)
+	return ok
+}
+
+// session requests have every scope
+func hasScope(c *gin.Context, scope string) bool {
+	value, ok := c.Get(apiTokenScopesKey)
+	if !ok {
+		return true
+	}
+
+	for _, s := range value.([]string) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func requireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !hasScope(c, scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("token lacks scope %s", scope)})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// accept "Authorization: Bearer <token>" in place of a session cookie, a bad
+// or expired token is rejected rather than treated as anonymous
+func apiTokenAuthentication(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authorization := c.GetHeader("Authorization")
+		if !strings.HasPrefix(authorization, "Bearer ") {
+			c.Next()
+			return
+		}
+		token := strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer "))
+
+		var apiToken ApiTokenTable
+		db.Where(&ApiTokenTable{TokenHash: hashToken(token)}).Find(&apiToken)
+		if apiToken.Id == 0 || (apiToken.ExpiresAt != nil && apiToken.ExpiresAt.Before(time.Now())) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid api token"})
+			return
+		}
+
+		var user UserTable
+		db.Find(&user, apiToken.UserId)
+		if user.Id == 0 || user.Disabled {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid api token"})
+			return
+		}
+
+		now := time.Now()
+		if err := db.Model(&apiToken).Update("last_used_at", &now).Error; err != nil {
+			fmt.Println(err)
+		}
+
+		// a token never rides on a session cookie sent along with it
+		c.Set(sessionIdKey, "")
+		c.Set(apiTokenScopesKey, strings.Split(apiToken.Scopes, ","))
+		c.Set(userKey, UserPrincipal{UserId: strconv.Itoa(user.Id)})
+		c.Next()
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	// shared secret the judger sends in X-Judger-Token when reporting results,
+	// empty disables the judger endpoints
+	JudgerToken string
+	// how long a request waits for a validator/generator run on the judge
+	ToolRunTimeout time.Duration
+	// key signing the session cookie, a random one is generated when
+	// SESSION_SECRET is unset so sessions don't survive a restart
+	SessionSecret []byte
+	// sessions expire after this long without a request
+	SessionMaxAge time.Duration
+
+	// "smtp" or "log", see newMailer
+	Mailer       string
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+	MailFrom     string
+	// where the log mailer writes .eml files, empty prints them
+	MailDir string
+	// frontend address used for links in mails
+	BaseURL string
+	// name shown for the account in authenticator apps
+	TotpIssuer string
+
+	// largest accepted source code, problems may set a lower limit
+	MaxSourceKB int
+	// a user may submit SubmissionBurst times at once, then once every
+	// SubmissionInterval; a burst of 0 disables the limit
+	SubmissionBurst    int
+	SubmissionInterval time.Duration
+	// submissions of a user waiting for a verdict, 0 disables the limit
+	MaxPendingSubmissions int
+}
+
+func getEnv(key string, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
+
+func getEnvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(getEnv(key, ""))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func loadSessionSecret() []byte {
+	if secret := getEnv("SESSION_SECRET", ""); secret != "" {
+		return []byte(secret)
+	}
+
+	fmt.Println("SESSION_SECRET is not set, using a random session secret")
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+	return secret
+}
+
+func loadConfig() Config {
+	return Config{
+		JudgerToken:    getEnv("JUDGER_TOKEN", ""),
+		ToolRunTimeout: time.Duration(getEnvInt("TOOL_RUN_TIMEOUT_SECONDS", 60)) * time.Second,
+		SessionSecret:  loadSessionSecret(),
+		SessionMaxAge:  time.Duration(getEnvInt("SESSION_MAX_AGE_HOURS", 24*7)) * time.Hour,
+		Mailer:         getEnv("MAILER", MAILER_LOG),
+		SMTPAddr:       getEnv("SMTP_ADDR", "localhost:25"),
+		SMTPUsername:   getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:   getEnv("SMTP_PASSWORD", ""),
+		MailFrom:       getEnv("MAIL_FROM", "noreply@localhost"),
+		MailDir:        getEnv("MAIL_DIR", ""),
+		BaseURL:        strings.TrimRight(getEnv("BASE_URL", "http://localhost:8080"), "/"),
+		TotpIssuer:     getEnv("TOTP_ISSUER", "go-online-judge"),
+
+		MaxSourceKB:           getEnvInt("MAX_SOURCE_KB", 64),
+		SubmissionBurst:       getEnvInt("SUBMISSION_BURST", 5),
+		SubmissionInterval:    time.Duration(getEnvInt("SUBMISSION_INTERVAL_SECONDS", 10)) * time.Second,
+		MaxPendingSubmissions: getEnvInt("MAX_PENDING_SUBMISSIONS", 5),
+	}
+}
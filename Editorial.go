@@ -0,0 +1,63 @@
+package main
+
+type ProblemEditorial struct {
+	Content            string              `json:"content"`
+	ContentHTML        string              `json:"contentHTML"`
+	ReferenceSolutions []ReferenceSolution `json:"referenceSolutions"`
+}
+
+// editorial content is Markdown with LaTeX, ContentHTML is its sanitized rendering
+type ProblemEditorialTable struct {
+	Id          int    `gorm:"auto_increment;primary_key;" json:"editorialId"`
+	Content     string `json:"content"`
+	ContentHTML string `json:"contentHTML"`
+
+	ProblemId int `gorm:"uniqueIndex" json:"problemId"`
+}
+
+type ProblemEditorialPutDTO struct {
+	Content string `json:"content"`
+}
+
+type ProblemEditorialUnlockDTO struct {
+	Unlocked bool `json:"unlocked"`
+}
+
+type ReferenceSolution struct {
+	Id             string `json:"id"`
+	Name           string `json:"name"`
+	Language       string `json:"language"`
+	Code           string `json:"code"`
+	ExpectedResult string `json:"expectedResult"`
+}
+
+// a known solution and the verdict it must get, e.g. an Accepted model
+// solution or a brute force expected to get Time Limit Exceeded
+type ReferenceSolutionTable struct {
+	Id             int    `gorm:"auto_increment;primary_key;" json:"referenceSolutionId"`
+	Name           string `gorm:"size:255" json:"name"`
+	Language       string `gorm:"size:255" json:"language"`
+	Code           string `json:"code"`
+	ExpectedResult string `gorm:"size:255" json:"expectedResult"`
+
+	// submission of the latest validation run, 0 if never validated
+	LastSubmissionId int `gorm:"not null;default:0" json:"lastSubmissionId"`
+
+	ProblemId int `gorm:"index" json:"problemId"`
+}
+
+type ReferenceSolutionPostDTO struct {
+	Name           string `json:"name"`
+	Language       string `json:"language"`
+	Code           string `json:"code"`
+	ExpectedResult string `json:"expectedResult"`
+}
+
+type ReferenceSolutionValidation struct {
+	ReferenceSolutionId int    `json:"referenceSolutionId"`
+	Name                string `json:"name"`
+	ExpectedResult      string `json:"expectedResult"`
+	ActualResult        string `json:"actualResult"`
+	SubmissionId        int    `json:"submissionId"`
+	Status              string `json:"status"`
+}
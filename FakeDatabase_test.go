@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// canned answer to one statement, rowsAffected is used for statements without rows
+type fakeResult struct {
+	columns      []string
+	rows         [][]driver.Value
+	rowsAffected int64
+}
+
+// database/sql driver answering every statement with respond, so code using
+// gorm can be tested without Postgres
+type fakeDatabase struct {
+	respond func(query string, args []driver.Value) fakeResult
+}
+
+func newFakeDB(t *testing.T, respond func(query string, args []driver.Value) fakeResult) *gorm.DB {
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sql.OpenDB(&fakeDatabase{respond: respond})}), &gorm.Config{
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+		Logger:                 logger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func (fake *fakeDatabase) Connect(ctx context.Context) (driver.Conn, error) {
+	return &fakeConn{fake: fake}, nil
+}
+
+func (fake *fakeDatabase) Driver() driver.Driver {
+	return fakeDriver{}
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	return nil, fmt.Errorf("fake database is opened through sql.OpenDB")
+}
+
+type fakeConn struct {
+	fake *fakeDatabase
+}
+
+func (conn *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{fake: conn.fake, query: query}, nil
+}
+
+func (conn *fakeConn) Close() error {
+	return nil
+}
+
+func (conn *fakeConn) Begin() (driver.Tx, error) {
+	return fakeTx{}, nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error {
+	return nil
+}
+
+func (fakeTx) Rollback() error {
+	return nil
+}
+
+type fakeStmt struct {
+	fake  *fakeDatabase
+	query string
+}
+
+func (stmt *fakeStmt) Close() error {
+	return nil
+}
+
+func (stmt *fakeStmt) NumInput() int {
+	return -1
+}
+
+func (stmt *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(stmt.fake.respond(stmt.query, args).rowsAffected), nil
+}
+
+func (stmt *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &fakeRows{result: stmt.fake.respond(stmt.query, args)}, nil
+}
+
+type fakeRows struct {
+	result fakeResult
+	next   int
+}
+
+func (rows *fakeRows) Columns() []string {
+	return rows.result.columns
+}
+
+func (rows *fakeRows) Close() error {
+	return nil
+}
+
+func (rows *fakeRows) Next(dest []driver.Value) error {
+	if rows.next >= len(rows.result.rows) {
+		return io.EOF
+	}
+	copy(dest, rows.result.rows[rows.next])
+	rows.next++
+	return nil
+}
@@ -2,9 +2,14 @@ package main
 
 type JudgerSubmissionData struct {
 	Id        int                  `json:"submissionId"`
+	RunId     string               `json:"runId"`
 	Language  string               `json:"language"`
 	Code      string               `json:"code"`
 	TestCases []JudgerTestCaseData `json:"testCases"`
+
+	// 0 means unlimited
+	MemoryLimitMB int `json:"memoryLimitMB"`
+	OutputLimitKB int `json:"outputLimitKB"`
 }
 
 type JudgerTestCaseData struct {
@@ -13,3 +18,11 @@ type JudgerTestCaseData struct {
 	Score          int     `json:"score"`
 	TimeOutSeconds float64 `json:"timeOutSeconds"`
 }
+
+// verdict reported back by the judger
+type JudgerResultDTO struct {
+	// runId of the judged payload
+	RunId        string  `json:"runId"`
+	Result       string  `json:"result"`
+	ExecutedTime float64 `json:"executedTime"`
+}
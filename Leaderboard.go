@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+const LEADERBOARD_KEY = "leaderboard"
+const LEADERBOARD_MEMBERS_KEY = "leaderboard:members"
+
+// the ZSET score is solved * LEADERBOARD_SOLVED_WEIGHT + total score, which
+// stays exact in a float64 for any realistic problem count
+const LEADERBOARD_SOLVED_WEIGHT = 1e9
+
+// members are "<inverted last AC time>:<userId>", Redis orders equal scores by
+// member so in descending order the earlier last AC comes first
+const leaderboardMaxUnix = 9999999999
+
+type LeaderboardEntry struct {
+	Rank           int64      `json:"rank"`
+	UserId         int        `json:"userId"`
+	Username       string     `json:"username"`
+	Solved         int        `json:"solved"`
+	Score          int        `json:"score"`
+	LastAcceptedAt *time.Time `json:"lastAcceptedAt"`
+}
+
+type Leaderboard struct {
+	rdb *redis.Client
+}
+
+func newLeaderboard(rdb *redis.Client) *Leaderboard {
+	return &Leaderboard{rdb: rdb}
+}
+
+func leaderboardScore(entry LeaderboardEntry) float64 {
+	return float64(entry.Solved)*LEADERBOARD_SOLVED_WEIGHT + float64(entry.Score)
+}
+
+func leaderboardMember(entry LeaderboardEntry) string {
+	var lastAcceptedAt int64
+	if entry.LastAcceptedAt != nil {
+		lastAcceptedAt = entry.LastAcceptedAt.Unix()
+	}
+	return fmt.Sprintf("%010d:%d", leaderboardMaxUnix-lastAcceptedAt, entry.UserId)
+}
+
+func parseLeaderboardEntry(z redis.Z) (LeaderboardEntry, error) {
+	var entry LeaderboardEntry
+
+	parts := strings.SplitN(z.Member.(string), ":", 2)
+	if len(parts) != 2 {
+		return entry, fmt.Errorf("invalid leaderboard member: %v", z.Member)
+	}
+	inverted, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return entry, err
+	}
+	entry.UserId, err = strconv.Atoi(parts[1])
+	if err != nil {
+		return entry, err
+	}
+
+	if lastAcceptedAt := leaderboardMaxUnix - inverted; lastAcceptedAt > 0 {
+		t := time.Unix(lastAcceptedAt, 0)
+		entry.LastAcceptedAt = &t
+	}
+	entry.Solved = int(z.Score / LEADERBOARD_SOLVED_WEIGHT)
+	entry.Score = int(math.Mod(z.Score, LEADERBOARD_SOLVED_WEIGHT))
+	return entry, nil
+}
+
+// solved count, score and last AC of userId, or of every user with userId 0.
+// A problem counts once, from its first accepted submission, and only while
+// it is published; its difficulty is the score
+func computeLeaderboardEntries(tx *gorm.DB, userId int, now time.Time) ([]LeaderboardEntry, error) {
+	solved := tx.Model(&SubmissionTable{}).
+		Select("submission_tables.user_id, problem_tables.difficulty, MIN(submission_tables.created_at) AS accepted_at").
+		Joins("JOIN problem_tables ON problem_tables.id = submission_tables.problem_id AND problem_tables.deleted_at IS NULL").
+		Where(visibleProblemsCondition(tx, now)).
+		Where("submission_tables.result = ? AND submission_tables.reference_solution_id = 0", SUBMISSION_ACCEPTED).
+		Group("submission_tables.user_id, problem_tables.id, problem_tables.difficulty")
+	if userId != 0 {
+		solved = solved.Where("submission_tables.user_id = ?", userId)
+	}
+
+	var rows []struct {
+		UserId         int
+		Solved         int
+		Score          int
+		LastAcceptedAt *time.Time
+	}
+	err := tx.Table("(?) AS solved", solved).
+		Select("user_id, COUNT(*) AS solved, COALESCE(SUM(difficulty), 0) AS score, MAX(accepted_at) AS last_accepted_at").
+		Group("user_id").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []LeaderboardEntry
+	for _, row := range rows {
+		entries = append(entries, LeaderboardEntry{
+			UserId:         row.UserId,
+			Solved:         row.Solved,
+			Score:          row.Score,
+			LastAcceptedAt: row.LastAcceptedAt,
+		})
+	}
+	return entries, nil
+}
+
+// swaps the member of a user, the script keeps concurrent updates of one user
+// from both removing the same old member and leaving two new ones behind
+var updateLeaderboardScript = redis.NewScript(`
+local oldMember = redis.call("HGET", KEYS[2], ARGV[1])
+if oldMember then
+	redis.call("ZREM", KEYS[1], oldMember)
+end
+if ARGV[2] == "" then
+	redis.call("HDEL", KEYS[2], ARGV[1])
+else
+	redis.call("ZADD", KEYS[1], ARGV[3], ARGV[2])
+	redis.call("HSET", KEYS[2], ARGV[1], ARGV[2])
+end
+return 1
+`)
+
+// replace the entry of a user, a user without solved problems is removed
+func (leaderboard *Leaderboard) Update(ctx context.Context, userId int, entries []LeaderboardEntry) error {
+	member, score := "", ""
+	for _, entry := range entries {
+		if entry.UserId == userId {
+			member = leaderboardMember(entry)
+			score = strconv.FormatFloat(leaderboardScore(entry), 'f', -1, 64)
+		}
+	}
+
+	return updateLeaderboardScript.Run(ctx, leaderboard.rdb, []string{LEADERBOARD_KEY, LEADERBOARD_MEMBERS_KEY},
+		userId, member, score).Err()
+}
+
+// swap in a leaderboard built from scratch
+func (leaderboard *Leaderboard) Rebuild(ctx context.Context, entries []LeaderboardEntry) error {
+	rebuildKey := LEADERBOARD_KEY + ":rebuild"
+	rebuildMembersKey := LEADERBOARD_MEMBERS_KEY + ":rebuild"
+
+	pipe := leaderboard.rdb.TxPipeline()
+	pipe.Del(ctx, rebuildKey, rebuildMembersKey)
+	for _, entry := range entries {
+		member := leaderboardMember(entry)
+		pipe.ZAdd(ctx, rebuildKey, &redis.Z{Score: leaderboardScore(entry), Member: member})
+		pipe.HSet(ctx, rebuildMembersKey, strconv.Itoa(entry.UserId), member)
+	}
+	if len(entries) > 0 {
+		pipe.Rename(ctx, rebuildKey, LEADERBOARD_KEY)
+		pipe.Rename(ctx, rebuildMembersKey, LEADERBOARD_MEMBERS_KEY)
+	} else {
+		pipe.Del(ctx, LEADERBOARD_KEY, LEADERBOARD_MEMBERS_KEY)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (leaderboard *Leaderboard) Count(ctx context.Context) (int64, error) {
+	return leaderboard.rdb.ZCard(ctx, LEADERBOARD_KEY).Result()
+}
+
+// entries from offset on, ranked from 1
+func (leaderboard *Leaderboard) Page(ctx context.Context, offset int, count int) ([]LeaderboardEntry, error) {
+	zs, err := leaderboard.rdb.ZRevRangeWithScores(ctx, LEADERBOARD_KEY, int64(offset), int64(offset+count-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []LeaderboardEntry{}
+	for i, z := range zs {
+		entry, err := parseLeaderboardEntry(z)
+		if err != nil {
+			return nil, err
+		}
+		entry.Rank = int64(offset + i + 1)
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// ok is false when the user hasn't solved anything yet
+func (leaderboard *Leaderboard) Entry(ctx context.Context, userId int) (LeaderboardEntry, bool, error) {
+	member, err := leaderboard.rdb.HGet(ctx, LEADERBOARD_MEMBERS_KEY, strconv.Itoa(userId)).Result()
+	if err == redis.Nil {
+		return LeaderboardEntry{}, false, nil
+	}
+	if err != nil {
+		return LeaderboardEntry{}, false, err
+	}
+
+	pipe := leaderboard.rdb.Pipeline()
+	rank := pipe.ZRevRank(ctx, LEADERBOARD_KEY, member)
+	score := pipe.ZScore(ctx, LEADERBOARD_KEY, member)
+	if _, err := pipe.Exec(ctx); err == redis.Nil {
+		return LeaderboardEntry{}, false, nil
+	} else if err != nil {
+		return LeaderboardEntry{}, false, err
+	}
+
+	entry, err := parseLeaderboardEntry(redis.Z{Score: score.Val(), Member: member})
+	if err != nil {
+		return entry, false, err
+	}
+	entry.Rank = rank.Val() + 1
+	return entry, true, nil
+}
+
+// user updates waiting for the worker, a full queue falls back to a rebuild
+const LEADERBOARD_UPDATE_QUEUE_SIZE = 256
+
+// every leaderboard write goes through a single goroutine, so a rebuild swapped
+// in after it was computed can't overwrite an entry updated in the meantime
+type LeaderboardWorker struct {
+	db          *gorm.DB
+	leaderboard *Leaderboard
+	updates     chan int
+	rebuilds    chan struct{}
+}
+
+func newLeaderboardWorker(db *gorm.DB, leaderboard *Leaderboard) *LeaderboardWorker {
+	return &LeaderboardWorker{
+		db:          db,
+		leaderboard: leaderboard,
+		updates:     make(chan int, LEADERBOARD_UPDATE_QUEUE_SIZE),
+		rebuilds:    make(chan struct{}, 1),
+	}
+}
+
+// queue recomputing the entry of a user
+func (worker *LeaderboardWorker) Update(userId int) {
+	select {
+	case worker.updates <- userId:
+	default:
+		worker.Rebuild()
+	}
+}
+
+// queue a rebuild from scratch, requests made while one is pending are merged
+func (worker *LeaderboardWorker) Rebuild() {
+	select {
+	case worker.rebuilds <- struct{}{}:
+	default:
+	}
+}
+
+// errors are only logged, the periodic rebuild catches up
+func (worker *LeaderboardWorker) Run() {
+	ctx := context.Background()
+	for {
+		var err error
+		select {
+		case userId := <-worker.updates:
+			err = updateLeaderboardEntry(ctx, worker.db, worker.leaderboard, userId)
+		case <-worker.rebuilds:
+			err = rebuildLeaderboard(ctx, worker.db, worker.leaderboard)
+		}
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+}
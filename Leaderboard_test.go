@@ -0,0 +1,98 @@
+package main
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func leaderboardTime(unix int64) *time.Time {
+	t := time.Unix(unix, 0)
+	return &t
+}
+
+func TestLeaderboardEntryRoundTrip(t *testing.T) {
+	tests := []LeaderboardEntry{
+		{UserId: 1, Solved: 1, Score: 800, LastAcceptedAt: leaderboardTime(1700000000)},
+		{UserId: 42, Solved: 250, Score: 999999, LastAcceptedAt: leaderboardTime(1)},
+		{UserId: 7, Solved: 3, Score: 0, LastAcceptedAt: leaderboardTime(2000000000)},
+		{UserId: 9, Solved: 2, Score: 100, LastAcceptedAt: nil},
+	}
+
+	for _, want := range tests {
+		z := redis.Z{Score: leaderboardScore(want), Member: leaderboardMember(want)}
+		got, err := parseLeaderboardEntry(z)
+		if err != nil {
+			t.Fatalf("parse %v: %v", z, err)
+		}
+
+		if got.UserId != want.UserId || got.Solved != want.Solved || got.Score != want.Score {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+		if (got.LastAcceptedAt == nil) != (want.LastAcceptedAt == nil) ||
+			(got.LastAcceptedAt != nil && !got.LastAcceptedAt.Equal(*want.LastAcceptedAt)) {
+			t.Errorf("got last AC %v, want %v", got.LastAcceptedAt, want.LastAcceptedAt)
+		}
+	}
+}
+
+func TestParseLeaderboardEntryInvalid(t *testing.T) {
+	for _, member := range []string{"", "12345", "abc:1", "0000000001:x"} {
+		if _, err := parseLeaderboardEntry(redis.Z{Member: member}); err == nil {
+			t.Errorf("parsed invalid member %q", member)
+		}
+	}
+}
+
+// Redis orders by score, then by member; ZREVRANGE reverses both
+func TestLeaderboardOrder(t *testing.T) {
+	entries := []LeaderboardEntry{
+		{UserId: 1, Solved: 2, Score: 100, LastAcceptedAt: leaderboardTime(3000)},
+		{UserId: 2, Solved: 3, Score: 10, LastAcceptedAt: leaderboardTime(5000)},
+		{UserId: 3, Solved: 2, Score: 100, LastAcceptedAt: leaderboardTime(1000)},
+		{UserId: 4, Solved: 2, Score: 200, LastAcceptedAt: leaderboardTime(9000)},
+		{UserId: 5, Solved: 2, Score: 100, LastAcceptedAt: leaderboardTime(2000)},
+	}
+	// more solved first, then higher score, then the earlier last AC
+	want := []int{2, 4, 3, 5, 1}
+
+	sort.Slice(entries, func(i, j int) bool {
+		scoreI, scoreJ := leaderboardScore(entries[i]), leaderboardScore(entries[j])
+		if scoreI != scoreJ {
+			return scoreI > scoreJ
+		}
+		return leaderboardMember(entries[i]) > leaderboardMember(entries[j])
+	})
+
+	for i, entry := range entries {
+		if entry.UserId != want[i] {
+			t.Fatalf("rank %d is user %d, want %d", i+1, entry.UserId, want[i])
+		}
+	}
+}
+
+func TestLeaderboardWorkerQueue(t *testing.T) {
+	worker := newLeaderboardWorker(nil, nil)
+
+	worker.Rebuild()
+	worker.Rebuild()
+	if len(worker.rebuilds) != 1 {
+		t.Errorf("got %d pending rebuilds, want 1", len(worker.rebuilds))
+	}
+	<-worker.rebuilds
+
+	for userId := 1; userId <= LEADERBOARD_UPDATE_QUEUE_SIZE; userId++ {
+		worker.Update(userId)
+	}
+	if len(worker.updates) != LEADERBOARD_UPDATE_QUEUE_SIZE || len(worker.rebuilds) != 0 {
+		t.Fatalf("got %d updates and %d rebuilds queued", len(worker.updates), len(worker.rebuilds))
+	}
+
+	// a full queue doesn't block the request, everyone is recomputed instead
+	worker.Update(LEADERBOARD_UPDATE_QUEUE_SIZE + 1)
+	if len(worker.rebuilds) != 1 {
+		t.Errorf("got %d pending rebuilds after overflow, want 1", len(worker.rebuilds))
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const LOCKOUT_USER = "user"
+const LOCKOUT_IP = "ip"
+
+// failed logins are counted over a sliding window, per username and per IP
+const LOGIN_FAILURE_WINDOW = 15 * time.Minute
+
+// from the 3rd failure a username has to wait 1s, 2s, 4s, ... between attempts
+const LOGIN_DELAY_AFTER = 3
+const LOGIN_MAX_DELAY = time.Minute
+
+// the 10th failure locks the username, each further lockout within a day
+// doubles the duration
+const LOGIN_MAX_USER_FAILURES = 10
+const LOGIN_USER_LOCKOUT = 15 * time.Minute
+const LOGIN_MAX_USER_LOCKOUT = 24 * time.Hour
+
+// an IP guessing across many usernames is locked as a whole
+const LOGIN_MAX_IP_FAILURES = 50
+const LOGIN_IP_LOCKOUT = 30 * time.Minute
+
+type LoginLockout struct {
+	Kind string `json:"kind"`
+	Key  string `json:"key"`
+	// lockouts of this key within the last day
+	Lockouts    int64     `json:"lockouts"`
+	LockedUntil time.Time `json:"lockedUntil"`
+}
+
+// failures live in "login-failures:<kind>:<key>" sorted sets scored by time,
+// active lockouts in "login-lockout:<kind>:<key>" keys expiring with the lockout
+type LoginThrottle struct {
+	rdb *redis.Client
+}
+
+func newLoginThrottle(rdb *redis.Client) *LoginThrottle {
+	return &LoginThrottle{rdb: rdb}
+}
+
+func loginFailuresKey(kind string, key string) string {
+	return "login-failures:" + kind + ":" + key
+}
+
+func loginLockoutKey(kind string, key string) string {
+	return "login-lockout:" + kind + ":" + key
+}
+
+func loginLockoutCountKey(kind string, key string) string {
+	return "login-lockouts:" + kind + ":" + key
+}
+
+func normalizeLoginUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// failures inside the window and the time of the latest one
+func (throttle *LoginThrottle) failures(ctx context.Context, kind string, key string) (int64, time.Time, error) {
+	now := time.Now()
+	failuresKey := loginFailuresKey(kind, key)
+
+	pipe := throttle.rdb.TxPipeline()
+	pipe.ZRemRangeByScore(ctx, failuresKey, "-inf", strconv.FormatInt(now.Add(-LOGIN_FAILURE_WINDOW).UnixNano(), 10))
+	count := pipe.ZCard(ctx, failuresKey)
+	latest := pipe.ZRevRangeWithScores(ctx, failuresKey, 0, 0)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, time.Time{}, err
+	}
+
+	var latestAt time.Time
+	if len(latest.Val()) > 0 {
+		latestAt = time.Unix(0, int64(latest.Val()[0].Score))
+	}
+	return count.Val(), latestAt, nil
+}
+
+// how long the client has to wait before it may try to log in again, 0 when
+// it may try now
+func (throttle *LoginThrottle) RetryAfter(ctx context.Context, ip string, username string) (time.Duration, error) {
+	username = normalizeLoginUsername(username)
+
+	var retryAfter time.Duration
+	for _, lockoutKey := range []string{loginLockoutKey(LOCKOUT_USER, username), loginLockoutKey(LOCKOUT_IP, ip)} {
+		ttl, err := throttle.rdb.PTTL(ctx, lockoutKey).Result()
+		if err != nil {
+			return 0, err
+		}
+		if ttl > retryAfter {
+			retryAfter = ttl
+		}
+	}
+	if retryAfter > 0 {
+		return retryAfter, nil
+	}
+
+	count, latestAt, err := throttle.failures(ctx, LOCKOUT_USER, username)
+	if err != nil || count < LOGIN_DELAY_AFTER {
+		return 0, err
+	}
+	delay := time.Second << (count - LOGIN_DELAY_AFTER)
+	if delay > LOGIN_MAX_DELAY || delay <= 0 {
+		delay = LOGIN_MAX_DELAY
+	}
+	if wait := time.Until(latestAt.Add(delay)); wait > 0 {
+		return wait, nil
+	}
+	return 0, nil
+}
+
+func (throttle *LoginThrottle) recordFailure(ctx context.Context, kind string, key string) (int64, error) {
+	now := time.Now()
+	failuresKey := loginFailuresKey(kind, key)
+
+	pipe := throttle.rdb.TxPipeline()
+	pipe.ZAdd(ctx, failuresKey, &redis.Z{Score: float64(now.UnixNano()), Member: now.UnixNano()})
+	pipe.Expire(ctx, failuresKey, LOGIN_FAILURE_WINDOW)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+
+	count, _, err := throttle.failures(ctx, kind, key)
+	return count, err
+}
+
+func (throttle *LoginThrottle) lock(ctx context.Context, kind string, key string, duration time.Duration) error {
+	pipe := throttle.rdb.TxPipeline()
+	pipe.Set(ctx, loginLockoutKey(kind, key), 1, duration)
+	pipe.Del(ctx, loginFailuresKey(kind, key))
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// count a failed login and lock the username or IP once over the limit
+func (throttle *LoginThrottle) RecordFailure(ctx context.Context, ip string, username string) error {
+	username = normalizeLoginUsername(username)
+
+	userFailures, err := throttle.recordFailure(ctx, LOCKOUT_USER, username)
+	if err != nil {
+		return err
+	}
+	if userFailures >= LOGIN_MAX_USER_FAILURES {
+		lockouts, err := throttle.rdb.Incr(ctx, loginLockoutCountKey(LOCKOUT_USER, username)).Result()
+		if err != nil {
+			return err
+		}
+		throttle.rdb.Expire(ctx, loginLockoutCountKey(LOCKOUT_USER, username), LOGIN_MAX_USER_LOCKOUT)
+
+		duration := LOGIN_USER_LOCKOUT << (lockouts - 1)
+		if duration > LOGIN_MAX_USER_LOCKOUT || duration <= 0 {
+			duration = LOGIN_MAX_USER_LOCKOUT
+		}
+		if err := throttle.lock(ctx, LOCKOUT_USER, username, duration); err != nil {
+			return err
+		}
+	}
+
+	ipFailures, err := throttle.recordFailure(ctx, LOCKOUT_IP, ip)
+	if err != nil {
+		return err
+	}
+	if ipFailures >= LOGIN_MAX_IP_FAILURES {
+		return throttle.lock(ctx, LOCKOUT_IP, ip, LOGIN_IP_LOCKOUT)
+	}
+	return nil
+}
+
+// a successful login forgets the username's failures, the IP's are kept
+func (throttle *LoginThrottle) RecordSuccess(ctx context.Context, username string) error {
+	username = normalizeLoginUsername(username)
+	return throttle.rdb.Del(ctx, loginFailuresKey(LOCKOUT_USER, username), loginLockoutCountKey(LOCKOUT_USER, username)).Err()
+}
+
+func (throttle *LoginThrottle) Lockouts(ctx context.Context) ([]LoginLockout, error) {
+	lockouts := []LoginLockout{}
+
+	iter := throttle.rdb.Scan(ctx, 0, "login-lockout:*", 100).Iterator()
+	for iter.Next(ctx) {
+		parts := strings.SplitN(iter.Val(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+
+		ttl, err := throttle.rdb.PTTL(ctx, iter.Val()).Result()
+		if err != nil {
+			return nil, err
+		}
+		// expired between SCAN and PTTL
+		if ttl <= 0 {
+			continue
+		}
+		count, err := throttle.rdb.Get(ctx, loginLockoutCountKey(parts[1], parts[2])).Int64()
+		if err != nil && err != redis.Nil {
+			return nil, err
+		}
+
+		lockouts = append(lockouts, LoginLockout{
+			Kind:        parts[1],
+			Key:         parts[2],
+			Lockouts:    count,
+			LockedUntil: time.Now().Add(ttl),
+		})
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	return lockouts, nil
+}
+
+// lift a lockout and forget the failures behind it
+func (throttle *LoginThrottle) Clear(ctx context.Context, kind string, key string) error {
+	if kind != LOCKOUT_USER && kind != LOCKOUT_IP {
+		return fmt.Errorf("invalid lockout kind: %s", kind)
+	}
+	if kind == LOCKOUT_USER {
+		key = normalizeLoginUsername(key)
+	}
+
+	return throttle.rdb.Del(ctx, loginLockoutKey(kind, key), loginFailuresKey(kind, key), loginLockoutCountKey(kind, key)).Err()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const MAILER_SMTP = "smtp"
+const MAILER_LOG = "log"
+
+type Mailer interface {
+	Send(to string, subject string, body string) error
+}
+
+func formatMail(from string, to string, subject string, body string) []byte {
+	var message strings.Builder
+	message.WriteString("From: " + from + "\r\n")
+	message.WriteString("To: " + to + "\r\n")
+	message.WriteString("Subject: " + subject + "\r\n")
+	message.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	message.WriteString("\r\n")
+	message.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return []byte(message.String())
+}
+
+type SMTPMailer struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+func (mailer SMTPMailer) Send(to string, subject string, body string) error {
+	var auth smtp.Auth
+	if mailer.Username != "" {
+		host, _, err := net.SplitHostPort(mailer.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", mailer.Username, mailer.Password, host)
+	}
+
+	return smtp.SendMail(mailer.Addr, auth, mailer.From, []string{to}, formatMail(mailer.From, to, subject, body))
+}
+
+// for local development: mails are written as .eml files to Dir, or printed
+// when Dir is empty
+type LogMailer struct {
+	Dir  string
+	From string
+}
+
+func (mailer LogMailer) Send(to string, subject string, body string) error {
+	message := formatMail(mailer.From, to, subject, body)
+	if mailer.Dir == "" {
+		fmt.Println(string(message))
+		return nil
+	}
+
+	if err := os.MkdirAll(mailer.Dir, 0755); err != nil {
+		return err
+	}
+	suffix, err := randomHex(4)
+	if err != nil {
+		return err
+	}
+	fileName := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405"), suffix)
+	return os.WriteFile(filepath.Join(mailer.Dir, fileName), message, 0644)
+}
+
+func newMailer(config Config) Mailer {
+	if config.Mailer == MAILER_SMTP {
+		return SMTPMailer{
+			Addr:     config.SMTPAddr,
+			Username: config.SMTPUsername,
+			Password: config.SMTPPassword,
+			From:     config.MailFrom,
+		}
+	}
+	return LogMailer{Dir: config.MailDir, From: config.MailFrom}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+var markdownRenderer = goldmark.New(goldmark.WithExtensions(extension.GFM))
+var htmlSanitizer = bluemonday.UGCPolicy()
+
+// placeholder for a LaTeX segment while Markdown is rendered, letters only so
+// Markdown leaves it untouched
+func mathPlaceholder(i int) string {
+	return fmt.Sprintf("ojmathsegment%dx", i)
+}
+
+// math delimiters, display ones first so "$$" isn't taken as two "$"
+var mathDelimiters = [][2]string{
+	{"$$", "$$"},
+	{`\[`, `\]`},
+	{`\(`, `\)`},
+	{"$", "$"},
+}
+
+// cut LaTeX segments out of src so Markdown doesn't treat "_" or "*" inside
+// formulas as emphasis, "\$" is a literal dollar sign
+func extractMath(src string) (string, []string) {
+	var out strings.Builder
+	var segments []string
+
+	for i := 0; i < len(src); {
+		if strings.HasPrefix(src[i:], `\$`) {
+			out.WriteString(`\$`)
+			i += 2
+			continue
+		}
+
+		matched := false
+		for _, delimiter := range mathDelimiters {
+			if !strings.HasPrefix(src[i:], delimiter[0]) {
+				continue
+			}
+
+			start := i + len(delimiter[0])
+			end := strings.Index(src[start:], delimiter[1])
+			// inline "$" must close on the same line and not be empty
+			if end <= 0 || (delimiter[0] == "$" && strings.Contains(src[start:start+end], "\n")) {
+				continue
+			}
+
+			segment := src[i : start+end+len(delimiter[1])]
+			out.WriteString(mathPlaceholder(len(segments)))
+			segments = append(segments, segment)
+			i += len(segment)
+			matched = true
+			break
+		}
+
+		if !matched {
+			out.WriteByte(src[i])
+			i++
+		}
+	}
+
+	return out.String(), segments
+}
+
+// render Markdown with LaTeX into sanitized HTML, formulas are kept with their
+// delimiters inside <span class="math"> for client side rendering (KaTeX/MathJax)
+func renderMarkdown(src string) (string, error) {
+	text, segments := extractMath(src)
+
+	var buf bytes.Buffer
+	if err := markdownRenderer.Convert([]byte(text), &buf); err != nil {
+		return "", err
+	}
+	rendered := htmlSanitizer.Sanitize(buf.String())
+
+	for i, segment := range segments {
+		rendered = strings.ReplaceAll(rendered, mathPlaceholder(i),
+			`<span class="math">`+html.EscapeString(segment)+`</span>`)
+	}
+
+	return rendered, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractMath(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		text     string
+		segments []string
+	}{
+		{"no math", "plain *text*", "plain *text*", nil},
+		{"inline", "a $x_1$ b", "a ojmathsegment0x b", []string{"$x_1$"}},
+		{"display", `$$\sum_i a_i$$`, "ojmathsegment0x", []string{`$$\sum_i a_i$$`}},
+		{"brackets", `\(a\) and \[b\]`, "ojmathsegment0x and ojmathsegment1x", []string{`\(a\)`, `\[b\]`}},
+		{"multiline display", "$$a\nb$$", "ojmathsegment0x", []string{"$$a\nb$$"}},
+		{"escaped dollar", `costs \$5 and $x$`, `costs \$5 and ojmathsegment0x`, []string{"$x$"}},
+		{"inline across lines", "$a\nb$", "$a\nb$", nil},
+		{"empty inline", "$$", "$$", nil},
+		{"unclosed", "$x and more", "$x and more", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			text, segments := extractMath(test.src)
+			if text != test.text || !reflect.DeepEqual(segments, test.segments) {
+				t.Errorf("got (%q, %q), want (%q, %q)", text, segments, test.text, test.segments)
+			}
+		})
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		html string
+	}{
+		{"heading", "# Title", "<h1>Title</h1>\n"},
+		{"math keeps underscores", "a $x_1 * y_2$ b",
+			`<p>a <span class="math">$x_1 * y_2$</span> b</p>` + "\n"},
+		{"display math", `$$\frac{a}{b}$$`, `<p><span class="math">$$\frac{a}{b}$$</span></p>` + "\n"},
+		{"escaped dollar", `costs \$5`, "<p>costs $5</p>\n"},
+		{"html in math is escaped", "$<img src=x onerror=alert(1)>$",
+			`<p><span class="math">$&lt;img src=x onerror=alert(1)&gt;$</span></p>` + "\n"},
+		{"raw html is dropped", "<script>alert(1)</script>\n\n**b**", "\n<p><strong>b</strong></p>\n"},
+		{"javascript link is dropped", "[x](javascript:alert(1))", "<p>x</p>\n"},
+		{"gfm table", "| a |\n|---|\n| 1 |",
+			"<table>\n<thead>\n<tr>\n<th>a</th>\n</tr>\n</thead>\n<tbody>\n<tr>\n<td>1</td>\n</tr>\n</tbody>\n</table>\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			html, err := renderMarkdown(test.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if html != test.html {
+				t.Errorf("got %q, want %q", html, test.html)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// one-off data migrations run at startup, a name is recorded once applied so
+// the migration never runs again
+type SchemaMigrationTable struct {
+	Name      string    `gorm:"primaryKey;size:255" json:"name"`
+	AppliedAt time.Time `json:"appliedAt"`
+}
+
+func runMigration(tx *gorm.DB, name string, migrate func(tx *gorm.DB) error) error {
+	var applied int64
+	if err := tx.Model(&SchemaMigrationTable{}).Where("name = ?", name).Count(&applied).Error; err != nil {
+		return err
+	}
+	if applied > 0 {
+		return nil
+	}
+
+	if err := migrate(tx); err != nil {
+		return fmt.Errorf("migration %s: %w", name, err)
+	}
+	return tx.Create(&SchemaMigrationTable{Name: name, AppliedAt: time.Now()}).Error
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetPagination(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		query    string
+		page     int
+		pageSize int
+		err      bool
+	}{
+		{"", 1, DEFAULT_PAGE_SIZE, false},
+		{"page=3&pageSize=50", 3, 50, false},
+		{"page=0", 1, DEFAULT_PAGE_SIZE, false},
+		{"page=-2&pageSize=-1", 1, DEFAULT_PAGE_SIZE, false},
+		{"pageSize=0", 1, DEFAULT_PAGE_SIZE, false},
+		{"pageSize=100", 1, MAX_PAGE_SIZE, false},
+		{"pageSize=101", 1, DEFAULT_PAGE_SIZE, false},
+		{"page=x", 0, 0, true},
+		{"pageSize=x", 0, 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", "/?"+test.query, nil)
+
+			page, pageSize, err := getPagination(c)
+			if (err != nil) != test.err {
+				t.Fatalf("got err %v, want err %v", err, test.err)
+			}
+			if !test.err && (page != test.page || pageSize != test.pageSize) {
+				t.Errorf("got (%d, %d), want (%d, %d)", page, pageSize, test.page, test.pageSize)
+			}
+		})
+	}
+}
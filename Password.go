@@ -0,0 +1,93 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// argon2id parameters for new hashes, hashes made with other parameters are
+// rehashed on the next successful login
+const argon2Memory = 64 * 1024
+const argon2Iterations = 3
+const argon2Parallelism = 2
+const argon2SaltLength = 16
+const argon2KeyLength = 32
+
+// PHC string format: $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, argon2Iterations, argon2Memory, argon2Parallelism, argon2KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+		argon2Memory, argon2Iterations, argon2Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// passwords stored before argon2id: base64(sha256(password)) without salt
+func legacySha256Password(password string) string {
+	h := sha256.Sum256([]byte(password))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// needsRehash is true when the password matches but dbPassword is a legacy hash
+// or uses outdated parameters
+func verifyPassword(password string, dbPassword string) (ok bool, needsRehash bool) {
+	if !strings.HasPrefix(dbPassword, "$argon2id$") {
+		ok = subtle.ConstantTimeCompare([]byte(legacySha256Password(password)), []byte(dbPassword)) == 1
+		return ok, ok
+	}
+
+	parts := strings.Split(dbPassword, "$")
+	if len(parts) != 6 {
+		return false, false
+	}
+
+	var version int
+	var memory, iterations uint32
+	var parallelism uint8
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, false
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &parallelism); err != nil {
+		return false, false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, false
+	}
+
+	otherKey := argon2.IDKey([]byte(password), salt, iterations, memory, parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, otherKey) != 1 {
+		return false, false
+	}
+
+	needsRehash = memory != argon2Memory || iterations != argon2Iterations || parallelism != argon2Parallelism ||
+		len(salt) != argon2SaltLength || len(key) != argon2KeyLength
+	return true, needsRehash
+}
+
+var dummyPasswordHash string
+var dummyPasswordOnce sync.Once
+
+// take as long as checking a real password so unknown usernames can't be told
+// apart by response time
+func verifyDummyPassword(password string) {
+	dummyPasswordOnce.Do(func() {
+		dummyPasswordHash, _ = hashPassword("dummy password")
+	})
+	verifyPassword(password, dummyPasswordHash)
+}
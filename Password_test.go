@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// an argon2id hash of password with the given parameters
+func argon2idHash(password string, memory uint32, iterations uint32, parallelism uint8) string {
+	salt := []byte("0123456789abcdef")
+	key := argon2.IDKey([]byte(password), salt, iterations, memory, parallelism, argon2KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, memory, iterations, parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func TestVerifyPassword(t *testing.T) {
+	current, err := hashPassword("secret123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	outdated := argon2idHash("secret123", 8*1024, 1, 1)
+
+	tests := []struct {
+		name        string
+		password    string
+		dbPassword  string
+		ok          bool
+		needsRehash bool
+	}{
+		{"current hash", "secret123", current, true, false},
+		{"current hash, wrong password", "secret124", current, false, false},
+		{"outdated parameters", "secret123", outdated, true, true},
+		{"outdated parameters, wrong password", "secret124", outdated, false, false},
+		{"legacy sha256", "secret123", legacySha256Password("secret123"), true, true},
+		{"legacy sha256, wrong password", "secret124", legacySha256Password("secret123"), false, false},
+		{"malformed hash", "secret123", "$argon2id$v=19$m=65536", false, false},
+		{"other argon2 version", "secret123", "$argon2id$v=16$m=65536,t=3,p=2$MDEyMzQ1Njc4OWFiY2RlZg$AAAA", false, false},
+		{"empty password", "", current, false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ok, needsRehash := verifyPassword(test.password, test.dbPassword)
+			if ok != test.ok || needsRehash != test.needsRehash {
+				t.Errorf("got (%v, %v), want (%v, %v)", ok, needsRehash, test.ok, test.needsRehash)
+			}
+		})
+	}
+}
+
+func TestHashPasswordSalts(t *testing.T) {
+	first, _ := hashPassword("secret123")
+	second, _ := hashPassword("secret123")
+	if first == second {
+		t.Error("two hashes of the same password are equal")
+	}
+}
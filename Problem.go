@@ -1,27 +1,104 @@
 package main
 
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
 type Problem struct {
 	Id          string     `json:"id"`
 	Title       string     `json:"title"`
 	Description string     `json:"description"`
-	TestCases   []TestCase `json:"testCases"`
+	Difficulty  int        `json:"difficulty"`
+	Tags        []string   `json:"tags"`
+	Visibility  string     `json:"visibility"`
+	PublishAt   *time.Time `json:"publishAt"`
+	CreatorId   int        `json:"creatorId"`
+
+	TimeLimitSeconds float64              `json:"timeLimitSeconds"`
+	MemoryLimitMB    int                  `json:"memoryLimitMB"`
+	OutputLimitKB    int                  `json:"outputLimitKB"`
+	SourceLimitKB    int                  `json:"sourceLimitKB"`
+	Languages        []ProblemLanguageDTO `json:"languages"`
+
+	// statement translation picked by ?lang= or Accept-Language
+	Statement          *ProblemStatement   `json:"statement"`
+	StatementLanguages []string            `json:"statementLanguages"`
+	Attachments        []ProblemAttachment `json:"attachments"`
+
+	TestCases []TestCase `json:"testCases"`
 }
 
 type ProblemTable struct {
-	Id          int    `gorm:"auto_increment;primary_key;" json:"problemId"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
+	Id          int        `gorm:"auto_increment;primary_key;" json:"problemId"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Difficulty  int        `gorm:"not null;default:0" json:"difficulty"`
+	Visibility  string     `gorm:"size:32;not null;default:published;index" json:"visibility"`
+	PublishAt   *time.Time `json:"publishAt"`
+	CreatorId   int        `gorm:"index" json:"creatorId"`
+
+	// editorial and reference solutions are shown to everyone once unlocked
+	EditorialUnlocked bool `gorm:"not null;default:false" json:"editorialUnlocked"`
+
+	// soft deleted problems stay in the trash until purged
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deletedAt"`
+
+	// 0 means no problem-level limit
+	TimeLimitSeconds float64 `gorm:"not null;default:0" json:"timeLimitSeconds"`
+	MemoryLimitMB    int     `gorm:"not null;default:0" json:"memoryLimitMB"`
+	OutputLimitKB    int     `gorm:"not null;default:0" json:"outputLimitKB"`
+	SourceLimitKB    int     `gorm:"not null;default:0" json:"sourceLimitKB"`
+}
+
+// allowed languages of a problem, no rows means every language is allowed
+type ProblemLanguageTable struct {
+	Id             int     `gorm:"auto_increment;primary_key;" json:"problemLanguageId"`
+	Language       string  `gorm:"size:255;not null" json:"language"`
+	TimeMultiplier float64 `gorm:"not null;default:1" json:"timeMultiplier"`
+
+	ProblemId int `gorm:"index" json:"problemId"`
+}
+
+type ProblemLanguageDTO struct {
+	Language       string  `json:"language"`
+	TimeMultiplier float64 `json:"timeMultiplier"`
 }
 
 type ProblemPostDTO struct {
-	Title       string            `json:"title"`
-	Description string            `json:"description"`
-	TestCases   []TestCasePostDTO `json:"testCases"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Difficulty  int        `json:"difficulty"`
+	Tags        []string   `json:"tags"`
+	Visibility  string     `json:"visibility"`
+	PublishAt   *time.Time `json:"publishAt"`
+
+	TimeLimitSeconds float64              `json:"timeLimitSeconds"`
+	MemoryLimitMB    int                  `json:"memoryLimitMB"`
+	OutputLimitKB    int                  `json:"outputLimitKB"`
+	SourceLimitKB    int                  `json:"sourceLimitKB"`
+	Languages        []ProblemLanguageDTO `json:"languages"`
+
+	TestCases []TestCasePostDTO `json:"testCases"`
 }
 
 type ProblemPutDTO struct {
-	Id          string           `json:"id"`
-	Title       string           `json:"title"`
-	Description string           `json:"description"`
-	TestCases   []TestCasePutDTO `json:"testCases"`
+	Id          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	// nil keeps the difficulty, 0 marks the problem unrated
+	Difficulty *int       `json:"difficulty"`
+	Tags       []string   `json:"tags"`
+	Visibility string     `json:"visibility"`
+	PublishAt  *time.Time `json:"publishAt"`
+
+	// nil keeps a limit, 0 removes it
+	TimeLimitSeconds *float64             `json:"timeLimitSeconds"`
+	MemoryLimitMB    *int                 `json:"memoryLimitMB"`
+	OutputLimitKB    *int                 `json:"outputLimitKB"`
+	SourceLimitKB    *int                 `json:"sourceLimitKB"`
+	Languages        []ProblemLanguageDTO `json:"languages"`
+
+	TestCases []TestCasePutDTO `json:"testCases"`
 }
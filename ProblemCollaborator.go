@@ -0,0 +1,19 @@
+package main
+
+type ProblemCollaborator struct {
+	UserId   int    `json:"userId"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+type ProblemCollaboratorTable struct {
+	Id   int    `gorm:"auto_increment;primary_key;" json:"collaboratorId"`
+	Role string `gorm:"size:32;not null" json:"role"`
+
+	ProblemId int `gorm:"uniqueIndex:idx_problem_collaborator" json:"problemId"`
+	UserId    int `gorm:"uniqueIndex:idx_problem_collaborator;index" json:"userId"`
+}
+
+type ProblemCollaboratorPutDTO struct {
+	Role string `json:"role"`
+}
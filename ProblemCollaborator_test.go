@@ -0,0 +1,143 @@
+package main
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// collaborators of problem 1: user 1 owns it, 2 edits it, 3 views it;
+// user 4 edits problem 2 only
+func fakeCollaborators(query string, args []driver.Value) fakeResult {
+	roles := map[[2]int64]string{
+		{1, 1}: PROBLEM_ROLE_OWNER,
+		{1, 2}: PROBLEM_ROLE_EDITOR,
+		{1, 3}: PROBLEM_ROLE_VIEWER,
+		{2, 4}: PROBLEM_ROLE_EDITOR,
+	}
+
+	result := fakeResult{columns: []string{"id", "role", "problem_id", "user_id"}}
+	if !strings.Contains(query, "problem_collaborator_tables") || len(args) != 2 {
+		return result
+	}
+	problemId, userId := args[0].(int64), args[1].(int64)
+	if role, ok := roles[[2]int64{problemId, userId}]; ok {
+		result.rows = append(result.rows, []driver.Value{int64(1), role, problemId, userId})
+	}
+	return result
+}
+
+// the user, permissions and token scopes the middlewares would have loaded,
+// userId 0 is anonymous and nil scopes a session request
+type testPrincipal struct {
+	userId      int
+	permissions []string
+	scopes      []string
+}
+
+func (principal testPrincipal) middleware(c *gin.Context) {
+	if principal.userId != 0 {
+		c.Set(userKey, UserPrincipal{UserId: strconv.Itoa(principal.userId)})
+		c.Set(permissionsKey, principal.permissions)
+	}
+	if principal.scopes != nil {
+		c.Set(apiTokenScopesKey, principal.scopes)
+	}
+	c.Next()
+}
+
+func TestProblemRoleLevel(t *testing.T) {
+	roles := []string{"", "unknown", PROBLEM_ROLE_VIEWER, PROBLEM_ROLE_EDITOR, PROBLEM_ROLE_OWNER}
+	for i := 2; i < len(roles); i++ {
+		if problemRoleLevel(roles[i]) <= problemRoleLevel(roles[i-1]) {
+			t.Errorf("%q should rank above %q", roles[i], roles[i-1])
+		}
+	}
+	if problemRoleLevel("unknown") != problemRoleLevel("") {
+		t.Errorf("unknown roles should grant nothing")
+	}
+}
+
+func TestAuthorizeProblemRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newFakeDB(t, fakeCollaborators)
+	manager := []string{PERMISSION_MANAGE_PROBLEMS}
+
+	tests := []struct {
+		name      string
+		principal testPrincipal
+		path      string
+		status    int
+	}{
+		{"anonymous", testPrincipal{}, "/problems/1", http.StatusUnauthorized},
+		{"owner", testPrincipal{userId: 1}, "/problems/1", http.StatusOK},
+		{"editor", testPrincipal{userId: 2}, "/problems/1", http.StatusOK},
+		{"viewer", testPrincipal{userId: 3}, "/problems/1", http.StatusForbidden},
+		{"editor of another problem", testPrincipal{userId: 4}, "/problems/1", http.StatusForbidden},
+		{"editor on own problem", testPrincipal{userId: 4}, "/problems/2", http.StatusOK},
+		{"not a collaborator", testPrincipal{userId: 5}, "/problems/1", http.StatusForbidden},
+		{"problem manager", testPrincipal{userId: 5, permissions: manager}, "/problems/1", http.StatusOK},
+		{"editor token with admin scope", testPrincipal{userId: 2, scopes: []string{SCOPE_PROBLEMS_ADMIN}},
+			"/problems/1", http.StatusOK},
+		{"editor token without admin scope", testPrincipal{userId: 2, scopes: []string{SCOPE_SUBMISSIONS_READ}},
+			"/problems/1", http.StatusForbidden},
+		{"manager token without admin scope", testPrincipal{userId: 5, permissions: manager, scopes: []string{}},
+			"/problems/1", http.StatusForbidden},
+		{"bad id", testPrincipal{userId: 2}, "/problems/x", http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(test.principal.middleware)
+			r.PUT("/problems/:id", authorizeProblemRole(db, PROBLEM_ROLE_EDITOR), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("PUT", test.path, nil))
+			if w.Code != test.status {
+				t.Errorf("got status %d, want %d", w.Code, test.status)
+			}
+		})
+	}
+}
+
+func TestHasProblemRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newFakeDB(t, fakeCollaborators)
+
+	tests := []struct {
+		name   string
+		userId int
+		role   string
+		has    bool
+	}{
+		{"owner is editor", 1, PROBLEM_ROLE_EDITOR, true},
+		{"owner is owner", 1, PROBLEM_ROLE_OWNER, true},
+		{"editor is viewer", 2, PROBLEM_ROLE_VIEWER, true},
+		{"editor is no owner", 2, PROBLEM_ROLE_OWNER, false},
+		{"viewer is viewer", 3, PROBLEM_ROLE_VIEWER, true},
+		{"viewer is no editor", 3, PROBLEM_ROLE_EDITOR, false},
+		{"other problem's editor", 4, PROBLEM_ROLE_VIEWER, false},
+		{"anonymous", 0, PROBLEM_ROLE_VIEWER, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			if test.userId != 0 {
+				c.Set(userKey, UserPrincipal{UserId: strconv.Itoa(test.userId)})
+			}
+
+			if has := hasProblemRole(c, db, 1, test.role); has != test.has {
+				t.Errorf("got %v, want %v", has, test.has)
+			}
+		})
+	}
+}
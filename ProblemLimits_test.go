@@ -0,0 +1,116 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateProblemLimits(t *testing.T) {
+	tests := []struct {
+		name             string
+		timeLimitSeconds float64
+		memoryLimitMB    int
+		outputLimitKB    int
+		sourceLimitKB    int
+		languages        []ProblemLanguageDTO
+		err              bool
+	}{
+		{"no limits", 0, 0, 0, 0, nil, false},
+		{"all limits", 2.5, 256, 1024, 64, []ProblemLanguageDTO{{"cpp", 1}, {"python", 3}}, false},
+		{"default multiplier", 1, 0, 0, 0, []ProblemLanguageDTO{{"cpp", 0}}, false},
+		{"negative time", -1, 0, 0, 0, nil, true},
+		{"negative memory", 0, -1, 0, 0, nil, true},
+		{"negative output", 0, 0, -1, 0, nil, true},
+		{"negative source", 0, 0, 0, -1, nil, true},
+		{"empty language", 0, 0, 0, 0, []ProblemLanguageDTO{{"", 1}}, true},
+		{"duplicate language", 0, 0, 0, 0, []ProblemLanguageDTO{{"cpp", 1}, {"cpp", 2}}, true},
+		{"negative multiplier", 0, 0, 0, 0, []ProblemLanguageDTO{{"cpp", -1}}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateProblemLimits(test.timeLimitSeconds, test.memoryLimitMB, test.outputLimitKB,
+				test.sourceLimitKB, test.languages)
+			if (err != nil) != test.err {
+				t.Errorf("got err %v, want err %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestFindTimeMultiplier(t *testing.T) {
+	languages := []ProblemLanguageTable{
+		{Language: "cpp", TimeMultiplier: 1},
+		{Language: "python", TimeMultiplier: 3},
+	}
+
+	tests := []struct {
+		name           string
+		languages      []ProblemLanguageTable
+		language       string
+		timeMultiplier float64
+		ok             bool
+	}{
+		{"any language allowed", nil, "go", 1, true},
+		{"allowed", languages, "python", 3, true},
+		{"not allowed", languages, "go", 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			timeMultiplier, ok := findTimeMultiplier(test.languages, test.language)
+			if timeMultiplier != test.timeMultiplier || ok != test.ok {
+				t.Errorf("got (%v, %v), want (%v, %v)", timeMultiplier, ok, test.timeMultiplier, test.ok)
+			}
+		})
+	}
+}
+
+func TestNewJudgerTestCaseData(t *testing.T) {
+	problem := ProblemTable{TimeLimitSeconds: 2}
+
+	tests := []struct {
+		name           string
+		testCase       TestCaseTable
+		timeMultiplier float64
+		timeOutSeconds float64
+	}{
+		{"problem limit", TestCaseTable{}, 1, 2},
+		{"testcase limit", TestCaseTable{TimeOutSeconds: 5}, 1, 5},
+		{"scaled problem limit", TestCaseTable{}, 3, 6},
+		{"scaled testcase limit", TestCaseTable{TimeOutSeconds: 0.5}, 2, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := newJudgerTestCaseData(test.testCase, problem, test.timeMultiplier)
+			if data.TimeOutSeconds != test.timeOutSeconds {
+				t.Errorf("got %v, want %v", data.TimeOutSeconds, test.timeOutSeconds)
+			}
+		})
+	}
+}
+
+func TestProblemLimitUpdates(t *testing.T) {
+	timeLimitSeconds, memoryLimitMB, zero := 1.5, 128, 0
+
+	tests := []struct {
+		name    string
+		dto     ProblemPutDTO
+		updates map[string]interface{}
+	}{
+		{"nothing sent", ProblemPutDTO{}, map[string]interface{}{}},
+		{"some sent", ProblemPutDTO{TimeLimitSeconds: &timeLimitSeconds, MemoryLimitMB: &memoryLimitMB},
+			map[string]interface{}{"time_limit_seconds": 1.5, "memory_limit_mb": 128}},
+		{"removed", ProblemPutDTO{OutputLimitKB: &zero, SourceLimitKB: &zero},
+			map[string]interface{}{"output_limit_kb": 0, "source_limit_kb": 0}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if updates := problemLimitUpdates(test.dto); !reflect.DeepEqual(updates, test.updates) {
+				t.Errorf("got %v, want %v", updates, test.updates)
+			}
+		})
+	}
+}
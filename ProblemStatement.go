@@ -0,0 +1,61 @@
+package main
+
+type ProblemStatement struct {
+	Language     string `json:"language"`
+	Title        string `json:"title"`
+	Legend       string `json:"legend"`
+	InputFormat  string `json:"inputFormat"`
+	OutputFormat string `json:"outputFormat"`
+	Notes        string `json:"notes"`
+
+	LegendHTML       string `json:"legendHTML"`
+	InputFormatHTML  string `json:"inputFormatHTML"`
+	OutputFormatHTML string `json:"outputFormatHTML"`
+	NotesHTML        string `json:"notesHTML"`
+}
+
+// one translation of a problem statement, sections are Markdown with LaTeX
+// and the *HTML columns hold the sanitized rendering of each section
+type ProblemStatementTable struct {
+	Id           int    `gorm:"auto_increment;primary_key;" json:"statementId"`
+	Language     string `gorm:"size:35;not null;uniqueIndex:idx_problem_statement_language" json:"language"`
+	Title        string `json:"title"`
+	Legend       string `json:"legend"`
+	InputFormat  string `json:"inputFormat"`
+	OutputFormat string `json:"outputFormat"`
+	Notes        string `json:"notes"`
+
+	LegendHTML       string `json:"legendHTML"`
+	InputFormatHTML  string `json:"inputFormatHTML"`
+	OutputFormatHTML string `json:"outputFormatHTML"`
+	NotesHTML        string `json:"notesHTML"`
+
+	ProblemId int `gorm:"uniqueIndex:idx_problem_statement_language" json:"problemId"`
+}
+
+type ProblemStatementPutDTO struct {
+	Title        string `json:"title"`
+	Legend       string `json:"legend"`
+	InputFormat  string `json:"inputFormat"`
+	OutputFormat string `json:"outputFormat"`
+	Notes        string `json:"notes"`
+}
+
+type ProblemAttachment struct {
+	Id          string `json:"id"`
+	FileName    string `json:"fileName"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+	Url         string `json:"url"`
+}
+
+type ProblemAttachmentTable struct {
+	Id          int    `gorm:"auto_increment;primary_key;" json:"attachmentId"`
+	FileName    string `gorm:"size:255;not null" json:"fileName"`
+	ContentType string `gorm:"size:255" json:"contentType"`
+	Size        int64  `json:"size"`
+	// relative to ATTACHMENT_DIR
+	Path string `gorm:"size:512;not null" json:"path"`
+
+	ProblemId int `gorm:"index" json:"problemId"`
+}
@@ -0,0 +1,31 @@
+package main
+
+type ProblemStats struct {
+	ProblemId        int            `json:"problemId"`
+	SubmissionCount  int64          `json:"submissionCount"`
+	JudgedCount      int64          `json:"judgedCount"`
+	AcceptedCount    int64          `json:"acceptedCount"`
+	DistinctSolvers  int64          `json:"distinctSolvers"`
+	DistinctAttempts int64          `json:"distinctAttempts"`
+	AcceptanceRatio  float64        `json:"acceptanceRatio"`
+	Verdicts         map[string]int `json:"verdicts"`
+	Languages        map[string]int `json:"languages"`
+
+	// executed time of accepted submissions in seconds
+	Runtime RuntimeDistribution `json:"runtime"`
+}
+
+type RuntimeDistribution struct {
+	Min     float64         `json:"min"`
+	Median  float64         `json:"median"`
+	P90     float64         `json:"p90"`
+	Max     float64         `json:"max"`
+	Buckets []RuntimeBucket `json:"buckets"`
+}
+
+// accepted submissions with executed time in (previous bucket, UpToSeconds],
+// the last bucket has UpToSeconds -1 and counts everything slower
+type RuntimeBucket struct {
+	UpToSeconds float64 `json:"upToSeconds"`
+	Count       int     `json:"count"`
+}
@@ -0,0 +1,56 @@
+package main
+
+type ProblemTool struct {
+	Kind     string `json:"kind"`
+	Language string `json:"language"`
+	Code     string `json:"code"`
+}
+
+// helper programs of a problem, one per kind:
+// a validator exits 0 for a valid input, a generator prints an input for its
+// arguments and the model solution prints the expected output of an input
+type ProblemToolTable struct {
+	Id       int    `gorm:"auto_increment;primary_key;" json:"toolId"`
+	Kind     string `gorm:"size:32;not null;uniqueIndex:idx_problem_tool_kind" json:"kind"`
+	Language string `gorm:"size:255;not null" json:"language"`
+	Code     string `json:"code"`
+
+	ProblemId int `gorm:"uniqueIndex:idx_problem_tool_kind" json:"problemId"`
+}
+
+type ProblemToolPutDTO struct {
+	Language string `json:"language"`
+	Code     string `json:"code"`
+}
+
+// a tool run executes one program on many inputs and waits for the outputs
+type JudgerToolRunData struct {
+	JobId          string          `json:"jobId"`
+	Kind           string          `json:"kind"`
+	Language       string          `json:"language"`
+	Code           string          `json:"code"`
+	TimeOutSeconds float64         `json:"timeOutSeconds"`
+	Runs           []JudgerToolRun `json:"runs"`
+}
+
+// Args is passed as command line arguments, Input as stdin
+type JudgerToolRun struct {
+	Input string `json:"input"`
+	Args  string `json:"args"`
+}
+
+type JudgerToolRunOutput struct {
+	ExitCode int    `json:"exitCode"`
+	Output   string `json:"output"`
+	Error    string `json:"error"`
+}
+
+type JudgerToolRunResultDTO struct {
+	Outputs []JudgerToolRunOutput `json:"outputs"`
+}
+
+// Index is the position of the testcase in the request or in the problem
+type TestCaseValidationError struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
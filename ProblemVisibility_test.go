@@ -0,0 +1,102 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestIsProblemVisible(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+
+	tests := []struct {
+		name       string
+		visibility string
+		publishAt  *time.Time
+		visible    bool
+		open       bool
+	}{
+		{"draft", PROBLEM_DRAFT, nil, false, false},
+		{"hidden", PROBLEM_HIDDEN, nil, false, false},
+		{"published", PROBLEM_PUBLISHED, nil, true, true},
+		{"published before now", PROBLEM_PUBLISHED, &past, true, true},
+		{"published at now", PROBLEM_PUBLISHED, &now, true, true},
+		{"scheduled", PROBLEM_PUBLISHED, &future, false, false},
+		{"archived", PROBLEM_ARCHIVED, nil, true, false},
+		{"archived scheduled", PROBLEM_ARCHIVED, &future, false, false},
+		{"draft with past publishAt", PROBLEM_DRAFT, &past, false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			problem := ProblemTable{Visibility: test.visibility, PublishAt: test.publishAt}
+			if visible := isProblemVisible(problem, now); visible != test.visible {
+				t.Errorf("visible: got %v, want %v", visible, test.visible)
+			}
+			if open := isProblemOpenForSubmission(problem, now); open != test.open {
+				t.Errorf("open for submission: got %v, want %v", open, test.open)
+			}
+		})
+	}
+}
+
+func TestIsValidProblemVisibility(t *testing.T) {
+	tests := []struct {
+		visibility string
+		valid      bool
+	}{
+		{PROBLEM_DRAFT, true},
+		{PROBLEM_PUBLISHED, true},
+		{PROBLEM_HIDDEN, true},
+		{PROBLEM_ARCHIVED, true},
+		{"", false},
+		{"public", false},
+		{"Published", false},
+	}
+
+	for _, test := range tests {
+		if valid := isValidProblemVisibility(test.visibility); valid != test.valid {
+			t.Errorf("%q: got %v, want %v", test.visibility, valid, test.valid)
+		}
+	}
+}
+
+// the query condition must list the same states isProblemVisible accepts
+func TestVisibleProblemsCondition(t *testing.T) {
+	sqlDB, err := sql.Open("pgx", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	query := db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+		var problems []ProblemTable
+		return visibleProblemsCondition(tx.Model(&ProblemTable{}), now).Find(&problems)
+	})
+
+	want := `problem_tables.visibility IN ('published','archived') AND ` +
+		`(problem_tables.publish_at IS NULL OR problem_tables.publish_at <= '2024-05-01 12:00:00')`
+	if !strings.Contains(query, want) {
+		t.Errorf("got %s, want it to contain %s", query, want)
+	}
+	for _, visibility := range []string{PROBLEM_DRAFT, PROBLEM_PUBLISHED, PROBLEM_HIDDEN, PROBLEM_ARCHIVED} {
+		listed := strings.Contains(query, "'"+visibility+"'")
+		if visible := isProblemVisible(ProblemTable{Visibility: visibility}, now); listed != visible {
+			t.Errorf("%s: listed %v, isProblemVisible %v", visibility, listed, visible)
+		}
+	}
+}
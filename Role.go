@@ -0,0 +1,290 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const permissionsKey = "permissions"
+
+// permissions granted through roles
+const PERMISSION_MANAGE_PROBLEMS = "problems:manage"
+const PERMISSION_REJUDGE = "submissions:rejudge"
+const PERMISSION_MANAGE_USERS = "users:manage"
+const PERMISSION_VIEW_ALL_SUBMISSIONS = "submissions:view_all"
+const PERMISSION_MANAGE_CONTESTS = "contests:manage"
+
+var allPermissions = []string{
+	PERMISSION_MANAGE_PROBLEMS,
+	PERMISSION_REJUDGE,
+	PERMISSION_MANAGE_USERS,
+	PERMISSION_VIEW_ALL_SUBMISSIONS,
+	PERMISSION_MANAGE_CONTESTS,
+}
+
+// built-in roles are created on startup and can't be deleted, admin always
+// holds every permission
+const ROLE_ADMIN = "admin"
+const ROLE_PROBLEM_SETTER = "problem-setter"
+const ROLE_MODERATOR = "moderator"
+
+var builtinRolePermissions = map[string][]string{
+	ROLE_ADMIN:          allPermissions,
+	ROLE_PROBLEM_SETTER: {PERMISSION_MANAGE_PROBLEMS},
+	ROLE_MODERATOR:      {PERMISSION_REJUDGE, PERMISSION_VIEW_ALL_SUBMISSIONS},
+}
+
+type Role struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+	Builtin     bool     `json:"builtin"`
+	// see RoleTable.RequireTwoFactor
+	RequireTwoFactor bool `json:"requireTwoFactor"`
+}
+
+type RoleTable struct {
+	Id          int    `gorm:"auto_increment;primary_key;" json:"roleId"`
+	Name        string `gorm:"size:64;not null;uniqueIndex" json:"name"`
+	Description string `gorm:"size:255" json:"description"`
+	// the role grants nothing to users who haven't enabled 2FA
+	RequireTwoFactor bool `gorm:"not null;default:false" json:"requireTwoFactor"`
+}
+
+type RolePermissionTable struct {
+	RoleId     int    `gorm:"primaryKey;autoIncrement:false" json:"roleId"`
+	Permission string `gorm:"primaryKey;size:64" json:"permission"`
+}
+
+type UserRoleTable struct {
+	UserId int `gorm:"primaryKey;autoIncrement:false" json:"userId"`
+	RoleId int `gorm:"primaryKey;autoIncrement:false;index" json:"roleId"`
+}
+
+type RolePutDTO struct {
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+type RoleTwoFactorPutDTO struct {
+	Required bool `json:"required"`
+}
+
+func isValidPermission(permission string) bool {
+	for _, p := range allPermissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func isBuiltinRole(name string) bool {
+	_, ok := builtinRolePermissions[name]
+	return ok
+}
+
+// create missing built-in roles, existing ones keep their edited permissions
+// except admin which is topped up with any new permission
+func seedRoles(tx *gorm.DB) error {
+	for name, permissions := range builtinRolePermissions {
+		var role RoleTable
+		if err := tx.Where(&RoleTable{Name: name}).Find(&role).Error; err != nil {
+			return err
+		}
+		if role.Id != 0 && name != ROLE_ADMIN {
+			continue
+		}
+
+		if role.Id == 0 {
+			role = RoleTable{Name: name}
+			if err := tx.Create(&role).Error; err != nil {
+				return err
+			}
+		}
+		for _, permission := range permissions {
+			rolePermission := RolePermissionTable{RoleId: role.Id, Permission: permission}
+			if err := tx.FirstOrCreate(&rolePermission, rolePermission).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// users used to be superusers through an integer authority column, give
+// those the admin role once
+func migrateAuthorityToRoles(tx *gorm.DB) error {
+	if !tx.Migrator().HasColumn(&UserTable{}, "authority") {
+		return nil
+	}
+
+	var adminRole RoleTable
+	if err := tx.Where(&RoleTable{Name: ROLE_ADMIN}).First(&adminRole).Error; err != nil {
+		return err
+	}
+
+	var userIds []int
+	if err := tx.Table("user_tables").Where("authority >= ?", 2).Pluck("id", &userIds).Error; err != nil {
+		return err
+	}
+	for _, userId := range userIds {
+		userRole := UserRoleTable{UserId: userId, RoleId: adminRole.Id}
+		if err := tx.FirstOrCreate(&userRole, userRole).Error; err != nil {
+			return err
+		}
+	}
+
+	// the column is kept so the previous release can still run against the
+	// database, a later migration drops it
+	return nil
+}
+
+func getRolePermissionsMap(tx *gorm.DB, roleIds []int) map[int][]string {
+	var rolePermissions []RolePermissionTable
+	tx.Where("role_id IN ?", roleIds).Order("permission").Find(&rolePermissions)
+
+	permissionsMap := make(map[int][]string)
+	for _, rolePermission := range rolePermissions {
+		permissionsMap[rolePermission.RoleId] = append(permissionsMap[rolePermission.RoleId], rolePermission.Permission)
+	}
+	return permissionsMap
+}
+
+func newRoles(tx *gorm.DB, roleTables []RoleTable) []Role {
+	var roleIds []int
+	for _, role := range roleTables {
+		roleIds = append(roleIds, role.Id)
+	}
+	permissionsMap := getRolePermissionsMap(tx, roleIds)
+
+	roles := []Role{}
+	for _, role := range roleTables {
+		permissions := permissionsMap[role.Id]
+		if permissions == nil {
+			permissions = []string{}
+		}
+		roles = append(roles, Role{
+			Name:        role.Name,
+			Description: role.Description,
+			Permissions: permissions,
+			Builtin:     isBuiltinRole(role.Name),
+
+			RequireTwoFactor: role.RequireTwoFactor,
+		})
+	}
+	return roles
+}
+
+func getUserRoleNames(tx *gorm.DB, userId int) []string {
+	roleNames := []string{}
+	tx.Model(&RoleTable{}).
+		Joins("JOIN user_role_tables ON user_role_tables.role_id = role_tables.id").
+		Where("user_role_tables.user_id = ?", userId).
+		Order("role_tables.name").
+		Pluck("role_tables.name", &roleNames)
+	return roleNames
+}
+
+func getUserRoleNamesMap(tx *gorm.DB, userIds []int) map[int][]string {
+	roleNamesMap := make(map[int][]string)
+
+	rows, err := tx.Model(&RoleTable{}).
+		Select("user_role_tables.user_id, role_tables.name").
+		Joins("JOIN user_role_tables ON user_role_tables.role_id = role_tables.id").
+		Where("user_role_tables.user_id IN ?", userIds).
+		Order("role_tables.name").Rows()
+	if err != nil {
+		fmt.Println(err)
+		return roleNamesMap
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userId int
+		var name string
+		rows.Scan(&userId, &name)
+
+		roleNamesMap[userId] = append(roleNamesMap[userId], name)
+	}
+
+	return roleNamesMap
+}
+
+func getUserPermissions(tx *gorm.DB, userId int) []string {
+	permissions := []string{}
+	query := tx.Model(&RolePermissionTable{}).
+		Distinct("role_permission_tables.permission").
+		Joins("JOIN user_role_tables ON user_role_tables.role_id = role_permission_tables.role_id").
+		Joins("JOIN role_tables ON role_tables.id = role_permission_tables.role_id").
+		Where("user_role_tables.user_id = ?", userId)
+	if _, ok := getEnabledTotp(tx, userId); !ok {
+		query = query.Where("role_tables.require_two_factor = ?", false)
+	}
+	query.Pluck("role_permission_tables.permission", &permissions)
+	return permissions
+}
+
+// the user holds a role that requires 2FA but hasn't enabled it
+func needsTwoFactorSetup(tx *gorm.DB, userId int) bool {
+	if _, ok := getEnabledTotp(tx, userId); ok {
+		return false
+	}
+
+	var count int64
+	tx.Model(&UserRoleTable{}).
+		Joins("JOIN role_tables ON role_tables.id = user_role_tables.role_id").
+		Where("user_role_tables.user_id = ? AND role_tables.require_two_factor = ?", userId, true).
+		Count(&count)
+	return count > 0
+}
+
+// look up the permissions of the current user on every request so role
+// changes apply without logging in again
+func loadPermissions(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if userId, ok := getCurrentUserId(c); ok {
+			c.Set(permissionsKey, getUserPermissions(db, userId))
+		}
+
+		c.Next()
+	}
+}
+
+func hasPermission(c *gin.Context, permission string) bool {
+	value, ok := c.Get(permissionsKey)
+	if !ok {
+		return false
+	}
+
+	for _, p := range value.([]string) {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// require permission on the route, api tokens also need the admin scope
+func authorizePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := getCurrentUser(c); !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		if !hasPermission(c, permission) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("missing permission %s", permission)})
+			return
+		}
+		if !hasScope(c, SCOPE_PROBLEMS_ADMIN) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("token lacks scope %s", SCOPE_PROBLEMS_ADMIN)})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAuthorizePermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name      string
+		principal testPrincipal
+		status    int
+	}{
+		{"anonymous", testPrincipal{}, http.StatusUnauthorized},
+		{"no roles", testPrincipal{userId: 1}, http.StatusForbidden},
+		{"other permission", testPrincipal{userId: 1, permissions: []string{PERMISSION_MANAGE_USERS}}, http.StatusForbidden},
+		{"granted", testPrincipal{userId: 1, permissions: []string{PERMISSION_REJUDGE}}, http.StatusOK},
+		{"token with admin scope", testPrincipal{userId: 1, permissions: []string{PERMISSION_REJUDGE},
+			scopes: []string{SCOPE_PROBLEMS_ADMIN}}, http.StatusOK},
+		{"token without admin scope", testPrincipal{userId: 1, permissions: []string{PERMISSION_REJUDGE},
+			scopes: []string{SCOPE_SUBMISSIONS_WRITE}}, http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(test.principal.middleware)
+			r.POST("/submissions/restart", authorizePermission(PERMISSION_REJUDGE), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("POST", "/submissions/restart", nil))
+			if w.Code != test.status {
+				t.Errorf("got status %d, want %d", w.Code, test.status)
+			}
+		})
+	}
+}
+
+func TestHasPermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name        string
+		permissions []string
+		has         bool
+	}{
+		{"not loaded", nil, false},
+		{"none", []string{}, false},
+		{"other", []string{PERMISSION_REJUDGE}, false},
+		{"granted", []string{PERMISSION_REJUDGE, PERMISSION_MANAGE_PROBLEMS}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			if test.permissions != nil {
+				c.Set(permissionsKey, test.permissions)
+			}
+
+			if has := hasPermission(c, PERMISSION_MANAGE_PROBLEMS); has != test.has {
+				t.Errorf("got %v, want %v", has, test.has)
+			}
+		})
+	}
+}
+
+func TestBuiltinRoles(t *testing.T) {
+	for name, permissions := range builtinRolePermissions {
+		if !isBuiltinRole(name) {
+			t.Errorf("%s is not reported as built-in", name)
+		}
+		for _, permission := range permissions {
+			if !isValidPermission(permission) {
+				t.Errorf("%s grants unknown permission %s", name, permission)
+			}
+		}
+	}
+	if len(builtinRolePermissions[ROLE_ADMIN]) != len(allPermissions) {
+		t.Errorf("admin should hold every permission")
+	}
+	if isBuiltinRole("contest-admin") || isValidPermission("problems:delete") {
+		t.Errorf("unknown names are accepted")
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+const sessionCookieName = "mysession"
+const sessionIdKey = "sessionId"
+
+// lastSeenAt is written back at most once per interval
+const sessionTouchInterval = time.Minute
+
+type SessionData struct {
+	Id         string    `json:"id"`
+	UserId     int       `json:"userId"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"userAgent"`
+}
+
+// a session as listed to its owner
+type SessionInfo struct {
+	Id         string    `json:"id"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"userAgent"`
+	Current    bool      `json:"current"`
+}
+
+// server-side sessions in Redis: "session:<id>" holds the SessionData as JSON and
+// "user-sessions:<userId>" the ids of a user's sessions, the cookie carries the id
+// signed with the configured secret
+type SessionStore struct {
+	rdb    *redis.Client
+	secret []byte
+	maxAge time.Duration
+}
+
+func newSessionStore(rdb *redis.Client, secret []byte, maxAge time.Duration) *SessionStore {
+	return &SessionStore{rdb: rdb, secret: secret, maxAge: maxAge}
+}
+
+func sessionKey(sessionId string) string {
+	return "session:" + sessionId
+}
+
+func userSessionsKey(userId int) string {
+	return "user-sessions:" + strconv.Itoa(userId)
+}
+
+func (store *SessionStore) signature(sessionId string) string {
+	mac := hmac.New(sha256.New, store.secret)
+	mac.Write([]byte(sessionId))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// cookie value is "<id>.<signature>", ok is false for a forged or malformed value
+func (store *SessionStore) parseCookie(value string) (string, bool) {
+	parts := strings.SplitN(value, ".", 2)
+	if len(parts) != 2 {
+		return "", false
+	}
+
+	expected := store.signature(parts[0])
+	return parts[0], subtle.ConstantTimeCompare([]byte(parts[1]), []byte(expected)) == 1
+}
+
+func (store *SessionStore) setCookie(c *gin.Context, value string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(sessionCookieName, value, maxAge, "/", "", c.Request.TLS != nil, true)
+}
+
+func (store *SessionStore) save(ctx context.Context, session SessionData) error {
+	bytes, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	pipe := store.rdb.TxPipeline()
+	pipe.Set(ctx, sessionKey(session.Id), bytes, store.maxAge)
+	pipe.SAdd(ctx, userSessionsKey(session.UserId), session.Id)
+	pipe.Expire(ctx, userSessionsKey(session.UserId), store.maxAge)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// start a new session for user and send its cookie
+func (store *SessionStore) Create(c *gin.Context, userId int) (SessionData, error) {
+	sessionId, err := randomHex(32)
+	if err != nil {
+		return SessionData{}, err
+	}
+
+	now := time.Now()
+	session := SessionData{
+		Id:         sessionId,
+		UserId:     userId,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		IP:         c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+	}
+	if err := store.save(c.Request.Context(), session); err != nil {
+		return SessionData{}, err
+	}
+
+	store.setCookie(c, sessionId+"."+store.signature(sessionId), int(store.maxAge.Seconds()))
+	return session, nil
+}
+
+// ok is false when the session expired or was revoked
+func (store *SessionStore) Get(ctx context.Context, sessionId string) (SessionData, bool, error) {
+	var session SessionData
+
+	bytes, err := store.rdb.Get(ctx, sessionKey(sessionId)).Bytes()
+	if err == redis.Nil {
+		return session, false, nil
+	}
+	if err != nil {
+		return session, false, err
+	}
+
+	if err := json.Unmarshal(bytes, &session); err != nil {
+		return session, false, err
+	}
+	return session, true, nil
+}
+
+// sessions of a user, ids of expired sessions are dropped on the way
+func (store *SessionStore) List(ctx context.Context, userId int) ([]SessionData, error) {
+	sessionIds, err := store.rdb.SMembers(ctx, userSessionsKey(userId)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []SessionData
+	for _, sessionId := range sessionIds {
+		session, ok, err := store.Get(ctx, sessionId)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			store.rdb.SRem(ctx, userSessionsKey(userId), sessionId)
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
+
+func (store *SessionStore) Delete(ctx context.Context, userId int, sessionId string) error {
+	pipe := store.rdb.TxPipeline()
+	pipe.Del(ctx, sessionKey(sessionId))
+	pipe.SRem(ctx, userSessionsKey(userId), sessionId)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// revoke every session of a user except keepSessionId, "" revokes all of them
+func (store *SessionStore) DeleteAll(ctx context.Context, userId int, keepSessionId string) error {
+	sessionIds, err := store.rdb.SMembers(ctx, userSessionsKey(userId)).Result()
+	if err != nil {
+		return err
+	}
+
+	for _, sessionId := range sessionIds {
+		if sessionId == keepSessionId {
+			continue
+		}
+		if err := store.Delete(ctx, userId, sessionId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// load the session of the request into the context, requests without a valid
+// session continue as anonymous
+func (store *SessionStore) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, err := c.Cookie(sessionCookieName)
+		if err != nil {
+			c.Next()
+			return
+		}
+		sessionId, ok := store.parseCookie(value)
+		if !ok {
+			c.Next()
+			return
+		}
+
+		ctx := c.Request.Context()
+		session, ok, err := store.Get(ctx, sessionId)
+		if err != nil {
+			fmt.Println(err)
+		}
+		if !ok {
+			c.Next()
+			return
+		}
+
+		// sliding expiration, the cookie is sent again so the browser keeps it
+		// as long as the server does
+		if time.Since(session.LastSeenAt) > sessionTouchInterval {
+			session.LastSeenAt = time.Now()
+			session.IP = c.ClientIP()
+			if err := store.save(ctx, session); err != nil {
+				fmt.Println(err)
+			} else {
+				store.setCookie(c, value, int(store.maxAge.Seconds()))
+			}
+		}
+
+		c.Set(sessionIdKey, session.Id)
+		c.Set(userKey, UserPrincipal{UserId: strconv.Itoa(session.UserId)})
+		c.Next()
+	}
+}
+
+// forget the session of the request and expire its cookie
+func (store *SessionStore) Destroy(c *gin.Context) error {
+	store.setCookie(c, "", -1)
+
+	sessionId := c.GetString(sessionIdKey)
+	userId, ok := getCurrentUserId(c)
+	if sessionId == "" || !ok {
+		return nil
+	}
+	return store.Delete(c.Request.Context(), userId, sessionId)
+}
@@ -1,5 +1,7 @@
 package main
 
+import "time"
+
 type SubmissionTable struct {
 	Id           int     `gorm:"auto_increment;primary_key;" json:"submissionId"`
 	Language     string  `gorm:"size:255" json:"language"`
@@ -9,6 +11,18 @@ type SubmissionTable struct {
 
 	ProblemId int `json:"problemId"`
 	UserId    int `json:"userId"`
+	// empty for submissions made before it was recorded
+	CreatedAt time.Time `gorm:"index" json:"createdAt"`
+
+	// set when the submission is a validation run of a reference solution
+	ReferenceSolutionId int `gorm:"not null;default:0;index" json:"referenceSolutionId"`
+
+	// SHA-256 of the read-only share link token, empty while not shared
+	ShareTokenHash string `gorm:"size:64;index" json:"-"`
+
+	// identifies the latest judge run, verdicts of earlier runs are rejected;
+	// empty for submissions queued before runs had ids
+	RunId string `gorm:"size:32;not null;default:''" json:"-"`
 }
 
 type SubmissionPostDTO struct {
@@ -18,11 +32,27 @@ type SubmissionPostDTO struct {
 }
 
 type Submission struct {
-	Id           int     `json:"submissionId"`
-	Language     string  `json:"language"`
-	Code         string  `json:"code"`
-	ExecutedTime float64 `json:"executedTime"`
-	Result       string  `json:"result"`
-	ProblemId    int     `json:"problemId"`
-	UserId       int     `json:"userId"`
+	Id           int       `json:"submissionId"`
+	Language     string    `json:"language"`
+	Code         string    `json:"code"`
+	ExecutedTime float64   `json:"executedTime"`
+	Result       string    `json:"result"`
+	ProblemId    int       `json:"problemId"`
+	ProblemTitle string    `json:"problemTitle"`
+	UserId       int       `json:"userId"`
+	CreatedAt    time.Time `json:"createdAt"`
+	Shared       bool      `json:"shared"`
+}
+
+// a submission in a list, without its code
+type SubmissionSummary struct {
+	Id           int       `json:"submissionId"`
+	Language     string    `json:"language"`
+	ExecutedTime float64   `json:"executedTime"`
+	Result       string    `json:"result"`
+	ProblemId    int       `json:"problemId"`
+	ProblemTitle string    `json:"problemTitle"`
+	UserId       int       `json:"userId"`
+	Username     string    `json:"username"`
+	CreatedAt    time.Time `json:"createdAt"`
 }
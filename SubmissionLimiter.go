@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// concurrent submissions of one user retry the bucket update this often
+const SUBMISSION_BUCKET_RETRIES = 5
+
+// a token bucket per user in the "submission-bucket:<userId>" hash, refilled
+// by one token every interval up to burst
+type SubmissionLimiter struct {
+	rdb      *redis.Client
+	burst    int
+	interval time.Duration
+}
+
+// burst 0 disables the limit
+func newSubmissionLimiter(rdb *redis.Client, burst int, interval time.Duration) *SubmissionLimiter {
+	return &SubmissionLimiter{rdb: rdb, burst: burst, interval: interval}
+}
+
+func submissionBucketKey(userId int) string {
+	return "submission-bucket:" + strconv.Itoa(userId)
+}
+
+// refill a bucket last updated at updatedAt and take a token from it, returns
+// the tokens left and, when the bucket was empty, how long until one is back
+func takeSubmissionToken(tokens float64, updatedAt time.Time, now time.Time, burst int,
+	interval time.Duration) (float64, time.Duration) {
+	elapsed := now.Sub(updatedAt)
+	if elapsed < 0 {
+		elapsed = 0
+	}
+
+	tokens = math.Min(float64(burst), tokens+float64(elapsed)/float64(interval))
+	if tokens >= 1 {
+		return tokens - 1, 0
+	}
+	return tokens, time.Duration(math.Ceil((1 - tokens) * float64(interval)))
+}
+
+// take a token for a new submission, returns how long the user has to wait
+// when the bucket is empty
+func (limiter *SubmissionLimiter) Take(ctx context.Context, userId int) (time.Duration, error) {
+	if limiter.burst <= 0 || limiter.interval <= 0 {
+		return 0, nil
+	}
+
+	key := submissionBucketKey(userId)
+	var retryAfter time.Duration
+	take := func(tx *redis.Tx) error {
+		now := time.Now()
+		tokens, updatedAt := float64(limiter.burst), now
+
+		values, err := tx.HMGet(ctx, key, "tokens", "updated_at").Result()
+		if err != nil {
+			return err
+		}
+		if storedTokens, ok := values[0].(string); ok {
+			if storedUpdatedAt, ok := values[1].(string); ok {
+				tokens, _ = strconv.ParseFloat(storedTokens, 64)
+				updatedAtNano, _ := strconv.ParseInt(storedUpdatedAt, 10, 64)
+				updatedAt = time.Unix(0, updatedAtNano)
+			}
+		}
+
+		tokens, retryAfter = takeSubmissionToken(tokens, updatedAt, now, limiter.burst, limiter.interval)
+
+		// the bucket is full again after burst intervals and can expire by then
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, key, "tokens", strconv.FormatFloat(tokens, 'f', -1, 64), "updated_at", now.UnixNano())
+			pipe.PExpire(ctx, key, time.Duration(limiter.burst)*limiter.interval)
+			return nil
+		})
+		return err
+	}
+
+	for i := 0; i < SUBMISSION_BUCKET_RETRIES; i++ {
+		err := limiter.rdb.Watch(ctx, take, key)
+		if err != redis.TxFailedErr {
+			return retryAfter, err
+		}
+	}
+	return 0, redis.TxFailedErr
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTakeSubmissionToken(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	interval := 10 * time.Second
+
+	tests := []struct {
+		name       string
+		tokens     float64
+		elapsed    time.Duration
+		tokensLeft float64
+		retryAfter time.Duration
+	}{
+		{"full bucket", 5, 0, 4, 0},
+		{"last token", 1, 0, 0, 0},
+		{"empty bucket", 0, 0, 0, 10 * time.Second},
+		{"half refilled", 0, 5 * time.Second, 0.5, 5 * time.Second},
+		{"refilled one", 0, 10 * time.Second, 0, 0},
+		{"refill stops at burst", 2, time.Hour, 4, 0},
+		{"partial token left", 0.25, 0, 0.25, 7500 * time.Millisecond},
+		{"clock went backwards", 0, -time.Minute, 0, 10 * time.Second},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tokensLeft, retryAfter := takeSubmissionToken(test.tokens, start, start.Add(test.elapsed), 5, interval)
+			if math.Abs(tokensLeft-test.tokensLeft) > 1e-9 || retryAfter != test.retryAfter {
+				t.Errorf("got (%v, %v), want (%v, %v)", tokensLeft, retryAfter, test.tokensLeft, test.retryAfter)
+			}
+		})
+	}
+}
+
+func TestTakeSubmissionTokenBurst(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	interval := 10 * time.Second
+	tokens, updatedAt := 3.0, now
+
+	take := func() time.Duration {
+		var retryAfter time.Duration
+		tokens, retryAfter = takeSubmissionToken(tokens, updatedAt, now, 3, interval)
+		updatedAt = now
+		return retryAfter
+	}
+
+	for i := 0; i < 3; i++ {
+		if retryAfter := take(); retryAfter != 0 {
+			t.Fatalf("submission %d of the burst waits %v", i+1, retryAfter)
+		}
+	}
+	if retryAfter := take(); retryAfter != interval {
+		t.Fatalf("submission after the burst waits %v, want %v", retryAfter, interval)
+	}
+
+	now = now.Add(interval)
+	if retryAfter := take(); retryAfter != 0 {
+		t.Fatalf("submission after one interval waits %v", retryAfter)
+	}
+	if retryAfter := take(); retryAfter != interval {
+		t.Fatalf("second submission after one interval waits %v, want %v", retryAfter, interval)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// read-only links are SHARED_SUBMISSION_PATH followed by the token
+const SHARED_SUBMISSION_PATH = "/submissions/shared/"
+
+func sharedSubmissionURL(baseURL string, token string) string {
+	return baseURL + SHARED_SUBMISSION_PATH + token
+}
+
+// a new read-only link replaces the previous one, the token is only
+// returned here
+func shareSubmission(db *gorm.DB, baseURL string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		submissionId, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get submission Id err: %s", err.Error()))
+			return
+		}
+
+		userId, _ := getCurrentUserId(c)
+		token, err := randomHex(32)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		result := db.Model(&SubmissionTable{}).Where("id = ? AND user_id = ?", submissionId, userId).
+			Update("share_token_hash", hashToken(token))
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "submission not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"token": token,
+			"url":   sharedSubmissionURL(baseURL, token),
+		})
+	}
+}
+
+// anyone holding the link may read the submission, nothing else
+func getSharedSubmission(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.Param("token")
+
+		var submission SubmissionTable
+		if token != "" {
+			db.Where("share_token_hash = ?", hashToken(token)).Find(&submission)
+		}
+		if submission.Id == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "submission not found"})
+			return
+		}
+
+		var problem ProblemTable
+		db.Unscoped().First(&problem, submission.ProblemId)
+
+		c.JSON(http.StatusOK, gin.H{
+			"data": newSubmission(submission, problem),
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// submission 5 of user 1, shared links are looked up by the stored hash
+func fakeSharedSubmissions() func(query string, args []driver.Value) fakeResult {
+	var shareTokenHash string
+	return func(query string, args []driver.Value) fakeResult {
+		switch {
+		case strings.HasPrefix(query, `UPDATE "submission_tables" SET "share_token_hash"`):
+			if args[1] != int64(5) || args[2] != int64(1) {
+				return fakeResult{}
+			}
+			shareTokenHash = args[0].(string)
+			return fakeResult{rowsAffected: 1}
+		case strings.Contains(query, `FROM "submission_tables"`):
+			result := fakeResult{columns: []string{"id", "user_id", "problem_id", "result", "share_token_hash"}}
+			if shareTokenHash != "" && args[0] == shareTokenHash {
+				result.rows = append(result.rows, []driver.Value{int64(5), int64(1), int64(3), SUBMISSION_ACCEPTED, shareTokenHash})
+			}
+			return result
+		case strings.Contains(query, `FROM "problem_tables"`):
+			return fakeResult{columns: []string{"id", "title"}, rows: [][]driver.Value{{int64(3), "A+B"}}}
+		}
+		return fakeResult{}
+	}
+}
+
+func TestSharedSubmissionLink(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newFakeDB(t, fakeSharedSubmissions())
+
+	r := gin.New()
+	r.POST("/submissions/:id/share", testPrincipal{userId: 1}.middleware, shareSubmission(db, "https://judge.example.com"))
+	r.GET(SHARED_SUBMISSION_PATH+":token", getSharedSubmission(db))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/submissions/5/share", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("share: got status %d, want %d", w.Code, http.StatusOK)
+	}
+	var shared struct {
+		Token string `json:"token"`
+		Url   string `json:"url"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &shared); err != nil {
+		t.Fatal(err)
+	}
+
+	link, err := url.Parse(shared.Url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.Host != "judge.example.com" {
+		t.Errorf("link %s doesn't point at the base url", shared.Url)
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{"returned link", link.Path, http.StatusOK},
+		{"wrong token", SHARED_SUBMISSION_PATH + strings.Repeat("0", len(shared.Token)), http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+			if w.Code != test.status {
+				t.Fatalf("got status %d, want %d", w.Code, test.status)
+			}
+			if test.status != http.StatusOK {
+				return
+			}
+
+			var body struct {
+				Data Submission `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Data.Id != 5 || body.Data.ProblemTitle != "A+B" || !body.Data.Shared {
+				t.Errorf("got %+v", body.Data)
+			}
+		})
+	}
+}
+
+func TestShareSubmissionOfOtherUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newFakeDB(t, fakeSharedSubmissions())
+
+	r := gin.New()
+	r.POST("/submissions/:id/share", testPrincipal{userId: 2}.middleware, shareSubmission(db, ""))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/submissions/5/share", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+type Tag struct {
+	Id           string `json:"id"`
+	Name         string `json:"name"`
+	ProblemCount int    `json:"problemCount"`
+}
+
+type TagTable struct {
+	Id   int    `gorm:"auto_increment;primary_key;" json:"tagId"`
+	Name string `gorm:"uniqueIndex;not null;size:255" json:"name"`
+}
+
+type ProblemTagTable struct {
+	ProblemId int `gorm:"primaryKey;autoIncrement:false" json:"problemId"`
+	TagId     int `gorm:"primaryKey;autoIncrement:false;index" json:"tagId"`
+}
+
+type TagPostDTO struct {
+	Name string `json:"name"`
+}
+
+type TagPutDTO struct {
+	Name string `json:"name"`
+}
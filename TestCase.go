@@ -3,6 +3,7 @@ package main
 type TestCase struct {
 	Id             string  `json:"id"`
 	Input          string  `json:"input"`
+	GeneratorArgs  string  `json:"generatorArgs"`
 	ExpectedOutput string  `json:"expectedOutput"`
 	Comment        string  `json:"comment"`
 	Score          int     `json:"score"`
@@ -12,6 +13,7 @@ type TestCase struct {
 type TestCaseTable struct {
 	Id             int     `gorm:"auto_increment;primary_key;" json:"testcaseId"`
 	Input          string  `json:"input"`
+	GeneratorArgs  string  `json:"generatorArgs"`
 	ExpectedOutput string  `json:"expectedOutput"`
 	Comment        string  `json:"comment"`
 	Score          int     `json:"score"`
@@ -22,6 +24,7 @@ type TestCaseTable struct {
 
 type TestCasePostDTO struct {
 	Input          string  `json:"input"`
+	GeneratorArgs  string  `json:"generatorArgs"`
 	ExpectedOutput string  `json:"expectedOutput"`
 	Comment        string  `json:"comment"`
 	Score          int     `json:"score"`
@@ -31,6 +34,7 @@ type TestCasePostDTO struct {
 type TestCasePutDTO struct {
 	Id             string  `json:"id"`
 	Input          string  `json:"input"`
+	GeneratorArgs  string  `json:"generatorArgs"`
 	ExpectedOutput string  `json:"expectedOutput"`
 	Comment        string  `json:"comment"`
 	Score          int     `json:"score"`
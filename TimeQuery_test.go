@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeQuery(t *testing.T) {
+	tests := []struct {
+		value    string
+		endOfDay bool
+		want     time.Time
+		err      bool
+	}{
+		{"2024-03-01T10:20:30Z", false, time.Date(2024, 3, 1, 10, 20, 30, 0, time.UTC), false},
+		{"2024-03-01T10:20:30Z", true, time.Date(2024, 3, 1, 10, 20, 30, 0, time.UTC), false},
+		{"2024-03-01T10:20:30+02:00", false, time.Date(2024, 3, 1, 8, 20, 30, 0, time.UTC), false},
+		{"2024-03-01", false, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), false},
+		{"2024-03-01", true, time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC), false},
+		{"2024-02-29", true, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), false},
+		{"2024-12-31", true, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), false},
+		{"2024-13-01", false, time.Time{}, true},
+		{"yesterday", false, time.Time{}, true},
+		{"", false, time.Time{}, true},
+	}
+
+	for _, test := range tests {
+		got, err := parseTimeQuery(test.value, test.endOfDay)
+		if (err != nil) != test.err {
+			t.Errorf("parseTimeQuery(%q, %v): got err %v, want err %v", test.value, test.endOfDay, err, test.err)
+			continue
+		}
+		if !test.err && !got.Equal(test.want) {
+			t.Errorf("parseTimeQuery(%q, %v) = %v, want %v", test.value, test.endOfDay, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RFC 6238 with the parameters every authenticator app supports
+const TOTP_PERIOD = 30
+const TOTP_DIGITS = 6
+const TOTP_SECRET_LENGTH = 20
+
+// codes from one step before or after are accepted for clock skew
+const TOTP_SKEW = 1
+
+const RECOVERY_CODE_COUNT = 10
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// a secret is created unconfirmed and only enabled once the user proved their
+// authenticator works
+type UserTotpTable struct {
+	UserId  int    `gorm:"primaryKey;autoIncrement:false" json:"userId"`
+	Secret  string `gorm:"size:64;not null" json:"-"`
+	Enabled bool   `gorm:"not null;default:false" json:"enabled"`
+	// a code can't be used twice
+	LastUsedStep int64     `gorm:"not null;default:0" json:"-"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// single-use codes for a lost authenticator, only their SHA-256 is stored
+type RecoveryCodeTable struct {
+	Id       int    `gorm:"auto_increment;primary_key;" json:"recoveryCodeId"`
+	CodeHash string `gorm:"size:64;not null" json:"-"`
+
+	UserId int `gorm:"index" json:"userId"`
+}
+
+type TwoFactorCodeDTO struct {
+	Code string `json:"code"`
+}
+
+type TwoFactorDisableDTO struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+func newTotpSecret() (string, error) {
+	secret := make([]byte, TOTP_SECRET_LENGTH)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// otpauth:// URI for authenticator apps, usually shown as a QR code
+func totpProvisioningURI(issuer string, username string, secret string) string {
+	values := url.Values{}
+	values.Set("secret", secret)
+	values.Set("issuer", issuer)
+	values.Set("algorithm", "SHA1")
+	values.Set("digits", fmt.Sprint(TOTP_DIGITS))
+	values.Set("period", fmt.Sprint(TOTP_PERIOD))
+
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(username)
+	return "otpauth://totp/" + label + "?" + values.Encode()
+}
+
+func totpCode(secret []byte, step int64) string {
+	var message [8]byte
+	binary.BigEndian.PutUint64(message[:], uint64(step))
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(message[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", TOTP_DIGITS, value%uint32(math.Pow10(TOTP_DIGITS)))
+}
+
+// the step code was generated for, ok is false for a wrong code or one from
+// a step at or before lastUsedStep
+func verifyTotp(secret string, code string, now time.Time, lastUsedStep int64) (int64, bool) {
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(code) != TOTP_DIGITS {
+		return 0, false
+	}
+
+	current := now.Unix() / TOTP_PERIOD
+	for step := current - TOTP_SKEW; step <= current+TOTP_SKEW; step++ {
+		if step <= lastUsedStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
+
+// replace the recovery codes of a user, the plain codes are returned once
+func generateRecoveryCodes(tx *gorm.DB, userId int) ([]string, error) {
+	if err := tx.Where(&RecoveryCodeTable{UserId: userId}).Delete(&RecoveryCodeTable{}).Error; err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	for i := 0; i < RECOVERY_CODE_COUNT; i++ {
+		code, err := randomHex(5)
+		if err != nil {
+			return nil, err
+		}
+		recoveryCode := RecoveryCodeTable{CodeHash: hashToken(code), UserId: userId}
+		if err := tx.Create(&recoveryCode).Error; err != nil {
+			return nil, err
+		}
+		codes = append(codes, code[:5]+"-"+code[5:])
+	}
+
+	return codes, nil
+}
+
+// check code against the user's authenticator, or use it up as a recovery code
+func verifySecondFactor(tx *gorm.DB, totp UserTotpTable, code string) bool {
+	code = strings.TrimSpace(code)
+	if step, ok := verifyTotp(totp.Secret, code, time.Now(), totp.LastUsedStep); ok {
+		// only one request may use the step
+		result := tx.Model(&UserTotpTable{}).
+			Where("user_id = ? AND last_used_step < ?", totp.UserId, step).Update("last_used_step", step)
+		return result.Error == nil && result.RowsAffected == 1
+	}
+
+	result := tx.Where("user_id = ? AND code_hash = ?", totp.UserId, hashToken(normalizeRecoveryCode(code))).
+		Delete(&RecoveryCodeTable{})
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+// the enabled TOTP of a user, ok is false when 2FA is off
+func getEnabledTotp(tx *gorm.DB, userId int) (UserTotpTable, bool) {
+	var totp UserTotpTable
+	tx.Where("user_id = ? AND enabled = ?", userId, true).Find(&totp)
+	return totp, totp.UserId != 0
+}
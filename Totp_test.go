@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// the SHA-1 secret of the RFC 6238 test vectors, "12345678901234567890"
+const rfcTotpSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestVerifyTotpVectors(t *testing.T) {
+	// the last 6 digits of the RFC 6238 appendix B codes
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, test := range tests {
+		step, ok := verifyTotp(rfcTotpSecret, test.code, time.Unix(test.unix, 0), 0)
+		if !ok || step != test.unix/TOTP_PERIOD {
+			t.Errorf("code %s at %d: got (%d, %v), want (%d, true)", test.code, test.unix, step, ok, test.unix/TOTP_PERIOD)
+		}
+	}
+}
+
+func TestVerifyTotpWindow(t *testing.T) {
+	// 1111111111 is step 37037037, the code is for that step
+	const code = "050471"
+	const step = 37037037
+
+	tests := []struct {
+		name         string
+		now          int64
+		code         string
+		lastUsedStep int64
+		ok           bool
+	}{
+		{"same step", step * TOTP_PERIOD, code, 0, true},
+		{"one step later", (step + 1) * TOTP_PERIOD, code, 0, true},
+		{"one step earlier", (step - 1) * TOTP_PERIOD, code, 0, true},
+		{"two steps later", (step + 2) * TOTP_PERIOD, code, 0, false},
+		{"two steps earlier", (step - 2) * TOTP_PERIOD, code, 0, false},
+		{"replayed", step * TOTP_PERIOD, code, step, false},
+		{"later step used", step * TOTP_PERIOD, code, step + 1, false},
+		{"earlier step used", (step + 1) * TOTP_PERIOD, code, step - 1, true},
+		{"wrong code", step * TOTP_PERIOD, "050472", 0, false},
+		{"short code", step * TOTP_PERIOD, "50471", 0, false},
+		{"empty code", step * TOTP_PERIOD, "", 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, ok := verifyTotp(rfcTotpSecret, test.code, time.Unix(test.now, 0), test.lastUsedStep)
+			if ok != test.ok {
+				t.Errorf("got %v, want %v", ok, test.ok)
+			}
+		})
+	}
+}
+
+func TestVerifyTotpInvalidSecret(t *testing.T) {
+	if _, ok := verifyTotp("not base32!", "050471", time.Unix(1111111111, 0), 0); ok {
+		t.Error("accepted a code for an invalid secret")
+	}
+}
+
+func TestNormalizeRecoveryCode(t *testing.T) {
+	tests := map[string]string{
+		"abcde-12345":   "abcde12345",
+		" ABCDE-12345 ": "abcde12345",
+		"abcde12345":    "abcde12345",
+	}
+	for code, want := range tests {
+		if got := normalizeRecoveryCode(code); got != want {
+			t.Errorf("normalizeRecoveryCode(%q) = %q, want %q", code, got, want)
+		}
+	}
+}
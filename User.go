@@ -1,12 +1,52 @@
 package main
 
+import "time"
+
 type UserTable struct {
-	Id        int    `gorm:"auto_increment;primary_key;" json:"userId"`
-	Username  string `gorm:"unique_index;not null;size:255" json:"username"`
-	Password  string `gorm:"not null;size:255" json:"password"`
-	Name      string `gorm:"size:255" json:"name"`
-	Email     string `gorm:"size:255" json:"email"`
-	Authority int    `json:"authority"`
+	Id int `gorm:"auto_increment;primary_key;" json:"userId"`
+	// unique regardless of case
+	Username string `gorm:"not null;size:255;uniqueIndex:idx_user_tables_lower_username,expression:LOWER(username)" json:"username"`
+	Password string `gorm:"not null;size:255" json:"password"`
+	Name     string `gorm:"size:255" json:"name"`
+	// unique regardless of case, apart from accounts registered before emails
+	// were required
+	Email         string    `gorm:"size:255;uniqueIndex:idx_user_tables_lower_email,expression:LOWER(email),where:email <> ''" json:"email"`
+	CreatedAt     time.Time `json:"createdAt"`
+	EmailVerified bool      `gorm:"not null;default:false" json:"emailVerified"`
+	// disabled users can't log in and their sessions and tokens are rejected
+	Disabled bool `gorm:"not null;default:false" json:"disabled"`
+
+	// privacy of the public profile
+	EmailPublic    bool `gorm:"not null;default:false" json:"emailPublic"`
+	ActivityPublic bool `gorm:"not null;default:true" json:"activityPublic"`
+
+	// Deprecated: replaced by roles and no longer read, kept for rolling back
+	Authority int `json:"-"`
+}
+
+// a user as seen by user managers
+type UserAccount struct {
+	Id            int       `json:"userId"`
+	Username      string    `json:"username"`
+	Name          string    `json:"name"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"emailVerified"`
+	CreatedAt     time.Time `json:"createdAt"`
+	Disabled      bool      `json:"disabled"`
+	Roles         []string  `json:"roles"`
+
+	SubmissionCount int64 `json:"submissionCount"`
+	AcceptedCount   int64 `json:"acceptedCount"`
+	SolvedCount     int64 `json:"solvedCount"`
+}
+
+type UserDisablePutDTO struct {
+	Disabled bool `json:"disabled"`
+}
+
+// an empty password resets to a generated one which is returned once
+type UserPasswordPutDTO struct {
+	Password string `json:"password"`
 }
 
 type UserPostDTO struct {
@@ -19,9 +59,11 @@ type UserPostDTO struct {
 type UserLoginDTO struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	// TOTP or recovery code, needed once 2FA is enabled
+	Code string `json:"code"`
 }
 
-type UserIdAuthorityPrincipal struct {
-	UserId    string
-	Authority string
+// roles and permissions are looked up per request, see loadPermissions
+type UserPrincipal struct {
+	UserId string
 }
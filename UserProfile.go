@@ -0,0 +1,38 @@
+package main
+
+import "time"
+
+// days covered by the activity heatmap
+const PROFILE_HEATMAP_DAYS = 365
+
+type ProfileProblem struct {
+	Id    int    `json:"id"`
+	Title string `json:"title"`
+}
+
+type HeatmapDay struct {
+	// YYYY-MM-DD
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+}
+
+// public profile, Email is empty and the activity fields are nil when the
+// user hides them
+type UserProfile struct {
+	Username string    `json:"username"`
+	Name     string    `json:"name"`
+	Email    string    `json:"email,omitempty"`
+	JoinedAt time.Time `json:"joinedAt"`
+
+	ActivityHidden bool             `json:"activityHidden"`
+	Solved         []ProfileProblem `json:"solved"`
+	Attempted      []ProfileProblem `json:"attempted"`
+	Verdicts       map[string]int   `json:"verdicts"`
+	Languages      map[string]int   `json:"languages"`
+	Heatmap        []HeatmapDay     `json:"heatmap"`
+}
+
+type UserPrivacy struct {
+	EmailPublic    bool `json:"emailPublic"`
+	ActivityPublic bool `json:"activityPublic"`
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// kinds of single-use tokens mailed to users
+const USER_TOKEN_EMAIL_VERIFICATION = "email_verification"
+const USER_TOKEN_PASSWORD_RESET = "password_reset"
+
+const EMAIL_VERIFICATION_TTL = 24 * time.Hour
+const PASSWORD_RESET_TTL = time.Hour
+
+// like api tokens only the SHA-256 of the token is stored
+type UserTokenTable struct {
+	Id        int       `gorm:"auto_increment;primary_key;" json:"userTokenId"`
+	Kind      string    `gorm:"size:32;not null" json:"kind"`
+	TokenHash string    `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	ExpiresAt time.Time `gorm:"not null" json:"expiresAt"`
+	// the address being verified, a later email change makes the token useless
+	Email string `gorm:"size:255" json:"email"`
+
+	UserId int `gorm:"index" json:"userId"`
+}
+
+type EmailVerifyDTO struct {
+	Token string `json:"token"`
+}
+
+type PasswordForgotDTO struct {
+	Email string `json:"email"`
+}
+
+type PasswordResetDTO struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// create a token of kind for user, replacing any earlier one of the same kind
+func issueUserToken(tx *gorm.DB, user UserTable, kind string, ttl time.Duration) (string, error) {
+	secret, err := randomHex(32)
+	if err != nil {
+		return "", err
+	}
+
+	if err := tx.Where(&UserTokenTable{UserId: user.Id, Kind: kind}).Delete(&UserTokenTable{}).Error; err != nil {
+		return "", err
+	}
+	userToken := UserTokenTable{
+		Kind:      kind,
+		TokenHash: hashToken(secret),
+		ExpiresAt: time.Now().Add(ttl),
+		Email:     user.Email,
+		UserId:    user.Id,
+	}
+	if err := tx.Create(&userToken).Error; err != nil {
+		return "", err
+	}
+
+	return secret, nil
+}
+
+// look up and delete a token so it can't be used twice, ok is false for an
+// unknown or expired token
+func consumeUserToken(tx *gorm.DB, token string, kind string) (UserTokenTable, bool, error) {
+	var userToken UserTokenTable
+	if err := tx.Where(&UserTokenTable{TokenHash: hashToken(token), Kind: kind}).Find(&userToken).Error; err != nil {
+		return userToken, false, err
+	}
+	if userToken.Id == 0 {
+		return userToken, false, nil
+	}
+
+	result := tx.Delete(&userToken)
+	if result.Error != nil {
+		return userToken, false, result.Error
+	}
+	// a concurrent request got it first
+	if result.RowsAffected == 0 {
+		return userToken, false, nil
+	}
+
+	return userToken, userToken.ExpiresAt.After(time.Now()), nil
+}
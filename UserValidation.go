@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/jackc/pgconn"
+	"gorm.io/gorm"
+)
+
+const MIN_PASSWORD_LENGTH = 8
+const MAX_PASSWORD_LENGTH = 128
+
+// the unique index on emails, see UserTable
+const EMAIL_INDEX = "idx_user_tables_lower_email"
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{3,32}$`)
+
+// static segments under /users that would shadow /users/:username routes
+var reservedUsernames = map[string]bool{
+	"login":    true,
+	"logout":   true,
+	"sessions": true,
+	"tokens":   true,
+	"email":    true,
+	"password": true,
+	"lockouts": true,
+	"2fa":      true,
+	"privacy":  true,
+}
+
+type FieldError struct {
+	Field string `json:"field"`
+	Error string `json:"error"`
+}
+
+func validateUsername(username string) string {
+	if !usernamePattern.MatchString(username) {
+		return "must be 3 to 32 letters, digits, '_' or '-'"
+	}
+	if reservedUsernames[strings.ToLower(username)] {
+		return "is reserved"
+	}
+	return ""
+}
+
+// at least one letter and one digit, and not the username itself
+func validatePassword(password string, username string) string {
+	if len(password) < MIN_PASSWORD_LENGTH || len(password) > MAX_PASSWORD_LENGTH {
+		return "must be 8 to 128 characters"
+	}
+
+	hasLetter, hasDigit := false, false
+	for _, r := range password {
+		hasLetter = hasLetter || unicode.IsLetter(r)
+		hasDigit = hasDigit || unicode.IsDigit(r)
+	}
+	if !hasLetter || !hasDigit {
+		return "must contain a letter and a digit"
+	}
+	if strings.EqualFold(password, username) {
+		return "must not be the username"
+	}
+	return ""
+}
+
+// a bare address, no display name
+func validateEmail(email string) string {
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email || len(email) > 255 {
+		return "is not a valid email address"
+	}
+	return ""
+}
+
+// trims the DTO in place and returns every field error
+func validateUserPostDTO(userDTO *UserPostDTO) []FieldError {
+	var fieldErrors []FieldError
+
+	userDTO.Username = strings.TrimSpace(userDTO.Username)
+	userDTO.Name = strings.TrimSpace(userDTO.Name)
+	userDTO.Email = strings.ToLower(strings.TrimSpace(userDTO.Email))
+
+	if message := validateUsername(userDTO.Username); message != "" {
+		fieldErrors = append(fieldErrors, FieldError{Field: "username", Error: message})
+	}
+	if message := validatePassword(userDTO.Password, userDTO.Username); message != "" {
+		fieldErrors = append(fieldErrors, FieldError{Field: "password", Error: message})
+	}
+	if message := validateEmail(userDTO.Email); message != "" {
+		fieldErrors = append(fieldErrors, FieldError{Field: "email", Error: message})
+	}
+	if len(userDTO.Name) > 255 {
+		fieldErrors = append(fieldErrors, FieldError{Field: "name", Error: "must be at most 255 characters"})
+	}
+
+	return fieldErrors
+}
+
+// name of the unique index a failed insert ran into
+func uniqueViolationConstraint(err error) (string, bool) {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return pgErr.ConstraintName, true
+	}
+	return "", false
+}
+
+// accounts whose lowercased column equals the one of an older account
+func findDuplicateUsers(tx *gorm.DB, column string) ([]UserTable, error) {
+	var duplicates []UserTable
+	older := tx.Table("user_tables AS older").Select("1").
+		Where(fmt.Sprintf("LOWER(older.%s) = LOWER(user_tables.%s) AND older.id < user_tables.id", column, column))
+	err := tx.Model(&UserTable{}).Where(column+" <> ''").Where("EXISTS (?)", older).Order("id").Find(&duplicates).Error
+	return duplicates, err
+}
+
+// usernames and emails weren't unique before, accounts clashing with an older
+// one are renamed or lose their email so the unique indexes can be built
+func migrateDuplicateUsers(tx *gorm.DB) error {
+	if !tx.Migrator().HasTable(&UserTable{}) {
+		return nil
+	}
+
+	duplicates, err := findDuplicateUsers(tx, "username")
+	if err != nil {
+		return err
+	}
+	for _, user := range duplicates {
+		username := fmt.Sprintf("%s-%d", user.Username, user.Id)
+		for {
+			var count int64
+			if err := tx.Model(&UserTable{}).Where("LOWER(username) = LOWER(?)", username).Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				break
+			}
+			username += "-dup"
+		}
+
+		fmt.Printf("renaming user %d with duplicate username %q to %q\n", user.Id, user.Username, username)
+		if err := tx.Model(&UserTable{}).Where("id = ?", user.Id).Update("username", username).Error; err != nil {
+			return err
+		}
+	}
+
+	duplicates, err = findDuplicateUsers(tx, "email")
+	if err != nil {
+		return err
+	}
+	for _, user := range duplicates {
+		fmt.Printf("removing duplicate email %q from user %d (%s)\n", user.Email, user.Id, user.Username)
+		err := tx.Model(&UserTable{}).Where("id = ?", user.Id).
+			Updates(map[string]interface{}{"email": "", "email_verified": false}).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	// replaced by the case-insensitive indexes
+	for _, index := range []string{"idx_user_tables_username", "idx_user_tables_email"} {
+		if tx.Migrator().HasIndex(&UserTable{}, index) {
+			if err := tx.Migrator().DropIndex(&UserTable{}, index); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateUserPostDTO(t *testing.T) {
+	tests := []struct {
+		name   string
+		user   UserPostDTO
+		fields []string
+	}{
+		{"valid", UserPostDTO{Username: "alice_1", Password: "secret123", Email: "alice@example.com"}, nil},
+		{"trimmed", UserPostDTO{Username: " alice ", Password: "secret123", Email: " Alice@Example.com "}, nil},
+		{"short username", UserPostDTO{Username: "al", Password: "secret123", Email: "al@example.com"}, []string{"username"}},
+		{"username characters", UserPostDTO{Username: "al ice", Password: "secret123", Email: "al@example.com"}, []string{"username"}},
+		{"reserved username", UserPostDTO{Username: "Login", Password: "secret123", Email: "al@example.com"}, []string{"username"}},
+		{"short password", UserPostDTO{Username: "alice", Password: "abc123", Email: "alice@example.com"}, []string{"password"}},
+		{"password without digit", UserPostDTO{Username: "alice", Password: "secretpassword", Email: "alice@example.com"}, []string{"password"}},
+		{"password is username", UserPostDTO{Username: "alice1234", Password: "ALICE1234", Email: "alice@example.com"}, []string{"password"}},
+		{"display name email", UserPostDTO{Username: "alice", Password: "secret123", Email: "Alice <alice@example.com>"}, []string{"email"}},
+		{"missing email", UserPostDTO{Username: "alice", Password: "secret123"}, []string{"email"}},
+		{"long name", UserPostDTO{Username: "alice", Password: "secret123", Email: "alice@example.com", Name: strings.Repeat("a", 256)}, []string{"name"}},
+		{"everything", UserPostDTO{Username: "a", Password: "a", Email: "a"}, []string{"username", "password", "email"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			user := test.user
+			fieldErrors := validateUserPostDTO(&user)
+
+			var fields []string
+			for _, fieldError := range fieldErrors {
+				fields = append(fields, fieldError.Field)
+			}
+			if strings.Join(fields, ",") != strings.Join(test.fields, ",") {
+				t.Errorf("got errors on %v, want %v (%v)", fields, test.fields, fieldErrors)
+			}
+		})
+	}
+}
+
+func TestValidateUserPostDTONormalizes(t *testing.T) {
+	user := UserPostDTO{Username: " alice ", Password: "secret123", Name: " Alice ", Email: " Alice@Example.COM "}
+	validateUserPostDTO(&user)
+
+	if user.Username != "alice" || user.Name != "Alice" || user.Email != "alice@example.com" {
+		t.Errorf("got %+v", user)
+	}
+}
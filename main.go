@@ -1,29 +1,118 @@
 package main
 
 import (
+	"bytes"
 	"context"
-	"crypto/sha256"
-	"encoding/base64"
-	"encoding/gob"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
+	"math"
 	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
-	"github.com/gin-contrib/sessions"
-	"github.com/gin-contrib/sessions/cookie"
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
+	"golang.org/x/text/language"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
 // custom map type
-type problemsMap map[string]string
+type problemsMap map[string]interface{}
 
 const userKey = "user"
 const SUBMISSION_NO_RESULT = "-"
+const SUBMISSION_ACCEPTED = "Accepted"
 const SUPPORTED_LANGUAGE = "kotlin"
+const MAX_PROBLEM_DIFFICULTY = 5000
+
+// final result of submissions to problems without testcases, they never reach
+// the judge
+const SUBMISSION_NOT_JUDGEABLE = "Not Judgeable"
+
+// set by the owner or an admin before a verdict arrived, cancelled submissions
+// don't count in any statistics
+const SUBMISSION_CANCELLED = "Cancelled"
+
+// a cancelled job still in its queue is removed from it; for one a judger
+// already picked up "<submissionId>:<runId>" is published on this channel and
+// the "submission-cancelled:<submissionId>:<runId>" key set
+const SUBMISSION_CANCEL_CHANNEL = "submission-cancel"
+const SUBMISSION_CANCEL_TTL = time.Hour
+
+// how long the payload of a queued job is kept to find it in its queue again
+const JUDGE_RUN_PAYLOAD_TTL = 24 * time.Hour
+
+// problem collaborator roles, each role includes the permissions of the roles below it
+const PROBLEM_ROLE_OWNER = "owner"
+const PROBLEM_ROLE_EDITOR = "editor"
+const PROBLEM_ROLE_VIEWER = "viewer"
+
+// uploaded problem attachments, served under /attachments to users who can
+// see the problem
+const ATTACHMENT_DIR = "attachments"
+const MAX_ATTACHMENT_SIZE = 10 << 20
+
+var attachmentNamePattern = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// deleted problems can only be purged after the retention period
+const PROBLEM_RETENTION = 30 * 24 * time.Hour
+
+// JSON escaping can grow source code up to 6 times, the rest of a submission
+// body is small
+const SUBMISSION_BODY_OVERHEAD = 4096
+
+// clients over the pending submission cap are asked to poll again after this
+const PENDING_SUBMISSIONS_RETRY_AFTER = 10 * time.Second
+
+// older pending submissions were lost on the way to the judge and don't count
+// towards the pending submission cap
+const PENDING_SUBMISSION_MAX_AGE = time.Hour
+
+// the leaderboard is rebuilt this often to pick up scheduled publishing
+const LEADERBOARD_REBUILD_INTERVAL = 15 * time.Minute
+
+// problem stats are cached in Redis until a new verdict arrives
+const PROBLEM_STATS_CACHE_TTL = 10 * time.Minute
+
+var runtimeBucketBounds = []float64{0.1, 0.25, 0.5, 1, 2, 5}
+
+// reference solution validation states
+const VALIDATION_PENDING = "pending"
+const VALIDATION_PASSED = "passed"
+const VALIDATION_FAILED = "failed"
+
+// problem tool kinds
+const PROBLEM_TOOL_VALIDATOR = "validator"
+const PROBLEM_TOOL_GENERATOR = "generator"
+const PROBLEM_TOOL_MODEL_SOLUTION = "model_solution"
+const TOOL_TIME_OUT_SECONDS = 10.0
+
+// problem visibility states
+const PROBLEM_DRAFT = "draft"
+const PROBLEM_PUBLISHED = "published"
+const PROBLEM_HIDDEN = "hidden"
+const PROBLEM_ARCHIVED = "archived"
+
+// list endpoints take ?page= (from 1) and ?pageSize=
+const DEFAULT_PAGE_SIZE = 20
+const MAX_PAGE_SIZE = 100
+
+// ?sort= values of the submission list and their columns
+var submissionSortColumns = map[string]string{
+	"id":           "id",
+	"createdAt":    "created_at",
+	"executedTime": "executed_time",
+}
 
 func initDatabase() (db *gorm.DB, err error) {
 	dsn := "host=localhost user=postgres password=123456789 " +
@@ -33,457 +122,4163 @@ func initDatabase() (db *gorm.DB, err error) {
 	return db, err
 }
 
-func encryptBySha256(s string) string {
-	h := sha256.Sum256([]byte(s))
-	return base64.StdEncoding.EncodeToString(h[:])
-}
+func isValidProblemVisibility(visibility string) bool {
+	switch visibility {
+	case PROBLEM_DRAFT, PROBLEM_PUBLISHED, PROBLEM_HIDDEN, PROBLEM_ARCHIVED:
+		return true
+	}
+	return false
+}
+
+// published and archived problems are public once publishAt has passed
+func isProblemVisible(problem ProblemTable, now time.Time) bool {
+	if problem.Visibility != PROBLEM_PUBLISHED && problem.Visibility != PROBLEM_ARCHIVED {
+		return false
+	}
+	return problem.PublishAt == nil || !problem.PublishAt.After(now)
+}
+
+// only published problems accept new submissions
+func isProblemOpenForSubmission(problem ProblemTable, now time.Time) bool {
+	return problem.Visibility == PROBLEM_PUBLISHED && isProblemVisible(problem, now)
+}
+
+// same rule as isProblemVisible, as a query condition on problem_tables
+func visibleProblemsCondition(tx *gorm.DB, now time.Time) *gorm.DB {
+	return tx.Where("problem_tables.visibility IN ? AND (problem_tables.publish_at IS NULL OR problem_tables.publish_at <= ?)",
+		[]string{PROBLEM_PUBLISHED, PROBLEM_ARCHIVED}, now)
+}
+
+func validateProblemLimits(timeLimitSeconds float64, memoryLimitMB int, outputLimitKB int, sourceLimitKB int,
+	languages []ProblemLanguageDTO) error {
+	if timeLimitSeconds < 0 || memoryLimitMB < 0 || outputLimitKB < 0 || sourceLimitKB < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+
+	seen := map[string]bool{}
+	for _, language := range languages {
+		if language.Language == "" {
+			return fmt.Errorf("language is empty")
+		}
+		if seen[language.Language] {
+			return fmt.Errorf("duplicate language: %s", language.Language)
+		}
+		if language.TimeMultiplier < 0 {
+			return fmt.Errorf("time multiplier of %s must not be negative", language.Language)
+		}
+		seen[language.Language] = true
+	}
+
+	return nil
+}
+
+// limits of a PUT, 0 for the ones that weren't sent
+func problemPutLimits(problemDTO ProblemPutDTO) (float64, int, int, int) {
+	var timeLimitSeconds float64
+	var memoryLimitMB, outputLimitKB, sourceLimitKB int
+	if problemDTO.TimeLimitSeconds != nil {
+		timeLimitSeconds = *problemDTO.TimeLimitSeconds
+	}
+	if problemDTO.MemoryLimitMB != nil {
+		memoryLimitMB = *problemDTO.MemoryLimitMB
+	}
+	if problemDTO.OutputLimitKB != nil {
+		outputLimitKB = *problemDTO.OutputLimitKB
+	}
+	if problemDTO.SourceLimitKB != nil {
+		sourceLimitKB = *problemDTO.SourceLimitKB
+	}
+	return timeLimitSeconds, memoryLimitMB, outputLimitKB, sourceLimitKB
+}
+
+// limits of a PUT that were sent, by column
+func problemLimitUpdates(problemDTO ProblemPutDTO) map[string]interface{} {
+	updates := map[string]interface{}{}
+	if problemDTO.TimeLimitSeconds != nil {
+		updates["time_limit_seconds"] = *problemDTO.TimeLimitSeconds
+	}
+	if problemDTO.MemoryLimitMB != nil {
+		updates["memory_limit_mb"] = *problemDTO.MemoryLimitMB
+	}
+	if problemDTO.OutputLimitKB != nil {
+		updates["output_limit_kb"] = *problemDTO.OutputLimitKB
+	}
+	if problemDTO.SourceLimitKB != nil {
+		updates["source_limit_kb"] = *problemDTO.SourceLimitKB
+	}
+	return updates
+}
+
+// replace the allowed languages of a problem
+func setProblemLanguages(tx *gorm.DB, problemId int, languages []ProblemLanguageDTO) error {
+	if err := tx.Where("problem_id = ?", problemId).Delete(&ProblemLanguageTable{}).Error; err != nil {
+		return err
+	}
+
+	for _, language := range languages {
+		timeMultiplier := language.TimeMultiplier
+		if timeMultiplier == 0 {
+			timeMultiplier = 1
+		}
+
+		problemLanguage := ProblemLanguageTable{
+			Language:       language.Language,
+			TimeMultiplier: timeMultiplier,
+			ProblemId:      problemId,
+		}
+		if err := tx.Create(&problemLanguage).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// time multiplier of a language, ok is false when the problem doesn't allow the language
+func findTimeMultiplier(languages []ProblemLanguageTable, language string) (float64, bool) {
+	if len(languages) == 0 {
+		return 1, true
+	}
+
+	for _, l := range languages {
+		if l.Language == language {
+			return l.TimeMultiplier, true
+		}
+	}
+	return 0, false
+}
+
+// testcase time limit falls back to the problem time limit, then scaled by the language
+func newJudgerTestCaseData(testCase TestCaseTable, problem ProblemTable, timeMultiplier float64) JudgerTestCaseData {
+	timeOutSeconds := testCase.TimeOutSeconds
+	if timeOutSeconds == 0 {
+		timeOutSeconds = problem.TimeLimitSeconds
+	}
+
+	return JudgerTestCaseData{
+		Input:          testCase.Input,
+		ExpectedOutput: testCase.ExpectedOutput,
+		Score:          testCase.Score,
+		TimeOutSeconds: timeOutSeconds * timeMultiplier,
+	}
+}
+
+func newJudgerSubmissionData(submission SubmissionTable, problem ProblemTable,
+	testCases []JudgerTestCaseData) JudgerSubmissionData {
+	return JudgerSubmissionData{
+		Id:            submission.Id,
+		RunId:         submission.RunId,
+		Language:      submission.Language,
+		Code:          submission.Code,
+		TestCases:     testCases,
+		MemoryLimitMB: problem.MemoryLimitMB,
+		OutputLimitKB: problem.OutputLimitKB,
+	}
+}
+
+// permanently delete a problem with everything that references it,
+// attachment files have to be removed after the transaction commits
+func purgeProblem(tx *gorm.DB, problemId int) error {
+	dependents := []interface{}{
+		&SubmissionTable{},
+		&TestCaseTable{},
+		&ProblemTagTable{},
+		&ProblemLanguageTable{},
+		&ProblemStatementTable{},
+		&ProblemAttachmentTable{},
+		&ProblemCollaboratorTable{},
+		&ProblemEditorialTable{},
+		&ReferenceSolutionTable{},
+		&ProblemToolTable{},
+	}
+	for _, dependent := range dependents {
+		if err := tx.Where("problem_id = ?", problemId).Delete(dependent).Error; err != nil {
+			return err
+		}
+	}
+
+	return tx.Unscoped().Delete(&ProblemTable{}, problemId).Error
+}
+
+func removeProblemAttachmentFiles(problemId int) {
+	if err := os.RemoveAll(filepath.Join(ATTACHMENT_DIR, strconv.Itoa(problemId))); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// build the judge job of a submission with the problem limits and testcases
+func loadJudgerSubmissionData(tx *gorm.DB, submission SubmissionTable, problem ProblemTable) (JudgerSubmissionData, error) {
+	var problemLanguages []ProblemLanguageTable
+	tx.Where("problem_id = ?", problem.Id).Find(&problemLanguages)
+	timeMultiplier, ok := findTimeMultiplier(problemLanguages, submission.Language)
+	if !ok {
+		timeMultiplier = 1
+	}
+
+	var testCases []TestCaseTable
+	if err := tx.Where("problem_id = ?", problem.Id).Order("id").Find(&testCases).Error; err != nil {
+		return JudgerSubmissionData{}, err
+	}
+
+	var judgerTestCases []JudgerTestCaseData
+	for _, testCase := range testCases {
+		judgerTestCases = append(judgerTestCases, newJudgerTestCaseData(testCase, problem, timeMultiplier))
+	}
+
+	return newJudgerSubmissionData(submission, problem, judgerTestCases), nil
+}
+
+// judge queues are Redis lists named after the language, the exact payload is
+// also kept under its run so a cancel can remove it from the queue
+func pushJudgerSubmissionData(rdb *redis.Client, judgerSubmissionData JudgerSubmissionData) error {
+	bytes, err := json.Marshal(judgerSubmissionData)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	pipe := rdb.TxPipeline()
+	pipe.Set(ctx, judgeRunPayloadKey(judgerSubmissionData.Id, judgerSubmissionData.RunId), bytes, JUDGE_RUN_PAYLOAD_TTL)
+	pipe.RPush(ctx, judgerSubmissionData.Language, bytes)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// compare the latest validation run of every reference solution with its expected result
+func getProblemValidationReport(tx *gorm.DB, problemId int) ([]ReferenceSolutionValidation, string) {
+	var solutions []ReferenceSolutionTable
+	tx.Where("problem_id = ?", problemId).Order("id").Find(&solutions)
+
+	var report []ReferenceSolutionValidation
+	status := VALIDATION_PASSED
+	for _, solution := range solutions {
+		validation := ReferenceSolutionValidation{
+			ReferenceSolutionId: solution.Id,
+			Name:                solution.Name,
+			ExpectedResult:      solution.ExpectedResult,
+			SubmissionId:        solution.LastSubmissionId,
+			Status:              VALIDATION_PENDING,
+		}
+
+		var submission SubmissionTable
+		if solution.LastSubmissionId != 0 {
+			tx.First(&submission, solution.LastSubmissionId)
+		}
+		if submission.Id != 0 && submission.Result != SUBMISSION_NO_RESULT {
+			validation.ActualResult = submission.Result
+			validation.Status = VALIDATION_FAILED
+			if submission.Result == solution.ExpectedResult {
+				validation.Status = VALIDATION_PASSED
+			}
+		}
+
+		// failed wins over pending, pending wins over passed
+		if validation.Status == VALIDATION_FAILED || (validation.Status == VALIDATION_PENDING && status == VALIDATION_PASSED) {
+			status = validation.Status
+		}
+		report = append(report, validation)
+	}
+	if len(solutions) == 0 {
+		status = VALIDATION_PENDING
+	}
+
+	return report, status
+}
+
+func isValidProblemToolKind(kind string) bool {
+	switch kind {
+	case PROBLEM_TOOL_VALIDATOR, PROBLEM_TOOL_GENERATOR, PROBLEM_TOOL_MODEL_SOLUTION:
+		return true
+	}
+	return false
+}
+
+func toolRunResultKey(jobId string) string {
+	return "tool-run-result:" + jobId
+}
+
+// run a problem tool on the judge and block until the judger reports its outputs,
+// tool runs have their own "tool:<language>" queues so submissions aren't delayed by them
+func runProblemTool(rdb *redis.Client, tool ProblemToolTable, runs []JudgerToolRun,
+	timeout time.Duration) ([]JudgerToolRunOutput, error) {
+	if len(runs) == 0 {
+		return nil, nil
+	}
+	if err := getConnection(rdb); err != nil {
+		return nil, err
+	}
+
+	jobId, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	bytes, err := json.Marshal(JudgerToolRunData{
+		JobId:          jobId,
+		Kind:           tool.Kind,
+		Language:       tool.Language,
+		Code:           tool.Code,
+		TimeOutSeconds: TOOL_TIME_OUT_SECONDS,
+		Runs:           runs,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	if err := rdb.RPush(ctx, "tool:"+tool.Language, bytes).Err(); err != nil {
+		return nil, err
+	}
+
+	reply, err := rdb.BLPop(ctx, timeout, toolRunResultKey(jobId)).Result()
+	if err == redis.Nil {
+		return nil, fmt.Errorf("%s run timed out", tool.Kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var result JudgerToolRunResultDTO
+	if err := json.Unmarshal([]byte(reply[1]), &result); err != nil {
+		return nil, err
+	}
+	if len(result.Outputs) != len(runs) {
+		return nil, fmt.Errorf("%s run returned %d outputs for %d runs", tool.Kind, len(result.Outputs), len(runs))
+	}
+
+	return result.Outputs, nil
+}
+
+// run the problem validator, if there is one, on every input and list the rejected ones
+func validateTestCaseInputs(tx *gorm.DB, rdb *redis.Client, problemId int, inputs []string,
+	timeout time.Duration) ([]TestCaseValidationError, error) {
+	var validator ProblemToolTable
+	tx.Where("problem_id = ? AND kind = ?", problemId, PROBLEM_TOOL_VALIDATOR).Find(&validator)
+	if validator.Id == 0 {
+		return nil, nil
+	}
+
+	return runValidator(rdb, validator, inputs, timeout)
+}
+
+func runValidator(rdb *redis.Client, validator ProblemToolTable, inputs []string,
+	timeout time.Duration) ([]TestCaseValidationError, error) {
+	var runs []JudgerToolRun
+	for _, input := range inputs {
+		runs = append(runs, JudgerToolRun{Input: input})
+	}
+
+	outputs, err := runProblemTool(rdb, validator, runs, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	var validationErrors []TestCaseValidationError
+	for i, output := range outputs {
+		if output.ExitCode != 0 {
+			validationErrors = append(validationErrors, TestCaseValidationError{Index: i, Error: output.Error})
+		}
+	}
+	return validationErrors, nil
+}
+
+// every push of a submission to a judge queue gets a new run id
+func newJudgeRunId() (string, error) {
+	return randomHex(8)
+}
+
+func submissionRunName(submissionId int, runId string) string {
+	return fmt.Sprintf("%d:%s", submissionId, runId)
+}
+
+func submissionCancelledKey(submissionId int, runId string) string {
+	return "submission-cancelled:" + submissionRunName(submissionId, runId)
+}
+
+func judgeRunPayloadKey(submissionId int, runId string) string {
+	return "judge-run:" + submissionRunName(submissionId, runId)
+}
+
+// remove the current run of a submission from its judge queue, or tell the
+// judgers to abort it when one already picked it up; removed is true when it
+// was still queued
+func cancelJudgerSubmission(ctx context.Context, rdb *redis.Client, submission SubmissionTable) (bool, error) {
+	payloadKey := judgeRunPayloadKey(submission.Id, submission.RunId)
+	payload, err := rdb.Get(ctx, payloadKey).Bytes()
+	if err != nil && err != redis.Nil {
+		return false, err
+	}
+	if err == nil {
+		removed, err := rdb.LRem(ctx, submission.Language, 1, payload).Result()
+		if err != nil {
+			return false, err
+		}
+		if err := rdb.Del(ctx, payloadKey).Err(); err != nil {
+			fmt.Println(err)
+		}
+		if removed > 0 {
+			return true, nil
+		}
+	}
+
+	pipe := rdb.TxPipeline()
+	pipe.Set(ctx, submissionCancelledKey(submission.Id, submission.RunId), 1, SUBMISSION_CANCEL_TTL)
+	pipe.Publish(ctx, SUBMISSION_CANCEL_CHANNEL, submissionRunName(submission.Id, submission.RunId))
+	_, err = pipe.Exec(ctx)
+	return false, err
+}
+
+func problemStatsKey(problemId int) string {
+	return fmt.Sprintf("problem-stats:%d", problemId)
+}
+
+// value at fraction p of sorted values, nearest rank
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	index := int(p*float64(len(sorted))+0.5) - 1
+	if index < 0 {
+		index = 0
+	}
+	if index >= len(sorted) {
+		index = len(sorted) - 1
+	}
+	return sorted[index]
+}
+
+func computeProblemStats(tx *gorm.DB, problemId int) (ProblemStats, error) {
+	stats := ProblemStats{
+		ProblemId: problemId,
+		Verdicts:  map[string]int{},
+		Languages: map[string]int{},
+	}
+	// validation runs of reference solutions and cancelled submissions are not counted
+	submissions := func() *gorm.DB {
+		return tx.Model(&SubmissionTable{}).
+			Where("problem_id = ? AND reference_solution_id = 0 AND result <> ?", problemId, SUBMISSION_CANCELLED)
+	}
+
+	var verdictCounts []struct {
+		Result string
+		Count  int
+	}
+	if err := submissions().Select("result, COUNT(*) AS count").Group("result").Scan(&verdictCounts).Error; err != nil {
+		return stats, err
+	}
+	for _, verdictCount := range verdictCounts {
+		stats.Verdicts[verdictCount.Result] = verdictCount.Count
+		stats.SubmissionCount += int64(verdictCount.Count)
+		if verdictCount.Result != SUBMISSION_NO_RESULT && verdictCount.Result != SUBMISSION_NOT_JUDGEABLE {
+			stats.JudgedCount += int64(verdictCount.Count)
+		}
+	}
+	stats.AcceptedCount = int64(stats.Verdicts[SUBMISSION_ACCEPTED])
+	if stats.JudgedCount > 0 {
+		stats.AcceptanceRatio = float64(stats.AcceptedCount) / float64(stats.JudgedCount)
+	}
+
+	var languageCounts []struct {
+		Language string
+		Count    int
+	}
+	if err := submissions().Select("language, COUNT(*) AS count").Group("language").Scan(&languageCounts).Error; err != nil {
+		return stats, err
+	}
+	for _, languageCount := range languageCounts {
+		stats.Languages[languageCount.Language] = languageCount.Count
+	}
+
+	submissions().Distinct("user_id").Count(&stats.DistinctAttempts)
+	submissions().Where("result = ?", SUBMISSION_ACCEPTED).Distinct("user_id").Count(&stats.DistinctSolvers)
+
+	var runtimes []float64
+	if err := submissions().Where("result = ?", SUBMISSION_ACCEPTED).Pluck("executed_time", &runtimes).Error; err != nil {
+		return stats, err
+	}
+	sort.Float64s(runtimes)
+
+	bucketCounts := make([]int, len(runtimeBucketBounds)+1)
+	for _, runtime := range runtimes {
+		bucket := sort.SearchFloat64s(runtimeBucketBounds, runtime)
+		bucketCounts[bucket]++
+	}
+	for i, count := range bucketCounts {
+		upTo := -1.0
+		if i < len(runtimeBucketBounds) {
+			upTo = runtimeBucketBounds[i]
+		}
+		stats.Runtime.Buckets = append(stats.Runtime.Buckets, RuntimeBucket{UpToSeconds: upTo, Count: count})
+	}
+	if len(runtimes) > 0 {
+		stats.Runtime.Min = runtimes[0]
+		stats.Runtime.Median = percentile(runtimes, 0.5)
+		stats.Runtime.P90 = percentile(runtimes, 0.9)
+		stats.Runtime.Max = runtimes[len(runtimes)-1]
+	}
+
+	return stats, nil
+}
+
+func updateLeaderboardEntry(ctx context.Context, db *gorm.DB, leaderboard *Leaderboard, userId int) error {
+	entries, err := computeLeaderboardEntries(db, userId, time.Now())
+	if err != nil {
+		return err
+	}
+	return leaderboard.Update(ctx, userId, entries)
+}
+
+func rebuildLeaderboard(ctx context.Context, db *gorm.DB, leaderboard *Leaderboard) error {
+	entries, err := computeLeaderboardEntries(db, 0, time.Now())
+	if err != nil {
+		return err
+	}
+	return leaderboard.Rebuild(ctx, entries)
+}
+
+func setLeaderboardUsernames(tx *gorm.DB, entries []LeaderboardEntry) {
+	var userIds []int
+	for _, entry := range entries {
+		userIds = append(userIds, entry.UserId)
+	}
+
+	var users []UserTable
+	tx.Select("id, username").Where("id IN ?", userIds).Find(&users)
+	usernames := make(map[int]string)
+	for _, user := range users {
+		usernames[user.Id] = user.Username
+	}
+
+	for i := range entries {
+		entries[i].Username = usernames[entries[i].UserId]
+	}
+}
+
+// activity part of a user profile, titles of problems the viewer can't see are
+// left out unless allProblems
+func computeUserActivity(tx *gorm.DB, profile *UserProfile, userId int, allProblems bool, now time.Time) error {
+	profile.Solved = []ProfileProblem{}
+	profile.Attempted = []ProfileProblem{}
+	profile.Verdicts = map[string]int{}
+	profile.Languages = map[string]int{}
+	profile.Heatmap = []HeatmapDay{}
+
+	// validation runs of reference solutions are not the user's own, cancelled
+	// submissions are left out
+	submissions := func() *gorm.DB {
+		return tx.Model(&SubmissionTable{}).
+			Where("user_id = ? AND reference_solution_id = 0 AND result <> ?", userId, SUBMISSION_CANCELLED)
+	}
+	problems := func() *gorm.DB {
+		query := tx.Model(&SubmissionTable{}).
+			Select("DISTINCT problem_tables.id, problem_tables.title").
+			Joins("JOIN problem_tables ON problem_tables.id = submission_tables.problem_id AND problem_tables.deleted_at IS NULL").
+			Where("submission_tables.user_id = ? AND submission_tables.reference_solution_id = 0", userId).
+			Where("submission_tables.result <> ?", SUBMISSION_CANCELLED)
+		if !allProblems {
+			query = query.Where(visibleProblemsCondition(tx, now))
+		}
+		return query.Order("problem_tables.id")
+	}
+
+	if err := problems().Where("submission_tables.result = ?", SUBMISSION_ACCEPTED).Scan(&profile.Solved).Error; err != nil {
+		return err
+	}
+	solvedIds := submissions().Select("problem_id").Where("result = ?", SUBMISSION_ACCEPTED)
+	if err := problems().Where("submission_tables.problem_id NOT IN (?)", solvedIds).Scan(&profile.Attempted).Error; err != nil {
+		return err
+	}
+
+	var verdictCounts []struct {
+		Result string
+		Count  int
+	}
+	if err := submissions().Select("result, COUNT(*) AS count").Group("result").Scan(&verdictCounts).Error; err != nil {
+		return err
+	}
+	for _, verdictCount := range verdictCounts {
+		profile.Verdicts[verdictCount.Result] = verdictCount.Count
+	}
+
+	var languageCounts []struct {
+		Language string
+		Count    int
+	}
+	if err := submissions().Select("language, COUNT(*) AS count").Group("language").Scan(&languageCounts).Error; err != nil {
+		return err
+	}
+	for _, languageCount := range languageCounts {
+		profile.Languages[languageCount.Language] = languageCount.Count
+	}
+
+	// days without submissions are left out
+	var dayCounts []struct {
+		Day   time.Time
+		Count int
+	}
+	since := now.AddDate(0, 0, -PROFILE_HEATMAP_DAYS)
+	if err := submissions().Select("DATE(created_at) AS day, COUNT(*) AS count").Where("created_at >= ?", since).
+		Group("day").Order("day").Scan(&dayCounts).Error; err != nil {
+		return err
+	}
+	for _, dayCount := range dayCounts {
+		profile.Heatmap = append(profile.Heatmap, HeatmapDay{Date: dayCount.Day.Format("2006-01-02"), Count: dayCount.Count})
+	}
+
+	return nil
+}
+
+// random string of n bytes in hex
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// render every Markdown section of a statement into its HTML column
+func renderProblemStatement(statement *ProblemStatementTable) error {
+	sections := []struct {
+		source string
+		html   *string
+	}{
+		{statement.Legend, &statement.LegendHTML},
+		{statement.InputFormat, &statement.InputFormatHTML},
+		{statement.OutputFormat, &statement.OutputFormatHTML},
+		{statement.Notes, &statement.NotesHTML},
+	}
+
+	for _, section := range sections {
+		rendered, err := renderMarkdown(section.source)
+		if err != nil {
+			return err
+		}
+		*section.html = rendered
+	}
+
+	return nil
+}
+
+func newProblemStatement(statement ProblemStatementTable) *ProblemStatement {
+	return &ProblemStatement{
+		Language:     statement.Language,
+		Title:        statement.Title,
+		Legend:       statement.Legend,
+		InputFormat:  statement.InputFormat,
+		OutputFormat: statement.OutputFormat,
+		Notes:        statement.Notes,
+
+		LegendHTML:       statement.LegendHTML,
+		InputFormatHTML:  statement.InputFormatHTML,
+		OutputFormatHTML: statement.OutputFormatHTML,
+		NotesHTML:        statement.NotesHTML,
+	}
+}
+
+// pick the translation matching ?lang= first, then Accept-Language, otherwise the first one
+func selectProblemStatement(c *gin.Context, statements []ProblemStatementTable) *ProblemStatement {
+	if len(statements) == 0 {
+		return nil
+	}
+
+	var tags []language.Tag
+	for _, statement := range statements {
+		tags = append(tags, language.Make(statement.Language))
+	}
+	_, index := language.MatchStrings(language.NewMatcher(tags), c.Query("lang"), c.GetHeader("Accept-Language"))
+
+	return newProblemStatement(statements[index])
+}
+
+func newProblemAttachment(attachment ProblemAttachmentTable) ProblemAttachment {
+	return ProblemAttachment{
+		Id:          strconv.Itoa(attachment.Id),
+		FileName:    attachment.FileName,
+		ContentType: attachment.ContentType,
+		Size:        attachment.Size,
+		Url:         "/attachments/" + attachment.Path,
+	}
+}
+
+// current session user set by the session middleware, ok is false for anonymous requests
+func getCurrentUser(c *gin.Context) (UserPrincipal, bool) {
+	value, ok := c.Get(userKey)
+	if !ok {
+		return UserPrincipal{}, false
+	}
+	user, ok := value.(UserPrincipal)
+	return user, ok
+}
+
+func getCurrentUserId(c *gin.Context) (int, bool) {
+	user, ok := getCurrentUser(c)
+	if !ok {
+		return 0, false
+	}
+
+	userId, err := strconv.Atoi(user.UserId)
+	return userId, err == nil
+}
+
+func problemRoleLevel(role string) int {
+	switch role {
+	case PROBLEM_ROLE_OWNER:
+		return 3
+	case PROBLEM_ROLE_EDITOR:
+		return 2
+	case PROBLEM_ROLE_VIEWER:
+		return 1
+	}
+	return 0
+}
+
+// role of a user on a problem, "" when the user isn't a collaborator
+func getProblemRole(tx *gorm.DB, problemId int, userId int) string {
+	var collaborator ProblemCollaboratorTable
+	tx.Where("problem_id = ? AND user_id = ?", problemId, userId).Find(&collaborator)
+	return collaborator.Role
+}
+
+// api tokens need the admin scope for anything beyond public problems
+func canManageProblems(c *gin.Context) bool {
+	return hasPermission(c, PERMISSION_MANAGE_PROBLEMS) && hasScope(c, SCOPE_PROBLEMS_ADMIN)
+}
+
+// users who manage problems have every role on every problem, api tokens
+// without the admin scope have none
+func hasProblemRole(c *gin.Context, tx *gorm.DB, problemId int, role string) bool {
+	if !hasScope(c, SCOPE_PROBLEMS_ADMIN) {
+		return false
+	}
+	if hasPermission(c, PERMISSION_MANAGE_PROBLEMS) {
+		return true
+	}
+
+	userId, ok := getCurrentUserId(c)
+	if !ok {
+		return false
+	}
+	return problemRoleLevel(getProblemRole(tx, problemId, userId)) >= problemRoleLevel(role)
+}
+
+// require at least role on the problem in the :id param
+func authorizeProblemRole(db *gorm.DB, role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := getCurrentUser(c); !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		problemId, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get problem Id err: %s", err.Error()))
+			c.Abort()
+			return
+		}
+
+		if !hasProblemRole(c, db, problemId, role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// judger callbacks are authenticated by a shared token instead of a session
+func authorizeJudger(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestToken := c.GetHeader("X-Judger-Token")
+		if token == "" || subtle.ConstantTimeCompare([]byte(requestToken), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func authorizeNormalUser(c *gin.Context) {
+	if _, ok := getCurrentUser(c); !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	c.Next()
+}
+
+// session and api token management can't be done with an api token
+func authorizeSessionUser(c *gin.Context) {
+	if _, ok := getCurrentUser(c); !ok || isApiTokenRequest(c) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	c.Next()
+}
+
+func getConnection(rdb *redis.Client) error {
+	ctx := context.Background()
+	pong, err := rdb.Ping(ctx).Result()
+
+	if err != nil {
+		fmt.Println("ping error, try reconnect", err.Error())
+		rdb = redis.NewClient(&redis.Options{})
+		pong, err = rdb.Ping(ctx).Result()
+		return err
+	}
+
+	fmt.Println("ping result:", pong)
+	return nil
+}
+
+// find tags by name, every name must match an existing tag
+func findTagsByNames(tx *gorm.DB, names []string) ([]TagTable, error) {
+	var tags []TagTable
+	if len(names) == 0 {
+		return tags, nil
+	}
+
+	if err := tx.Where("name IN ?", names).Find(&tags).Error; err != nil {
+		return nil, err
+	}
+
+	found := map[string]bool{}
+	for _, tag := range tags {
+		found[tag.Name] = true
+	}
+	var unknown []string
+	for _, name := range names {
+		if !found[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if unknown != nil {
+		return nil, fmt.Errorf("unknown tags: %s", strings.Join(unknown, ", "))
+	}
+
+	return tags, nil
+}
+
+// replace all tags of a problem
+func setProblemTags(tx *gorm.DB, problemId int, tags []TagTable) error {
+	if err := tx.Where("problem_id = ?", problemId).Delete(&ProblemTagTable{}).Error; err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		if err := tx.Create(&ProblemTagTable{ProblemId: problemId, TagId: tag.Id}).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// problemId -> tag names
+func getProblemTagNamesMap(tx *gorm.DB, problemIds []int) map[int][]string {
+	tagNamesMap := make(map[int][]string)
+	if len(problemIds) == 0 {
+		return tagNamesMap
+	}
+
+	rows, err := tx.Table("problem_tag_tables").
+		Select("problem_tag_tables.problem_id, tag_tables.name").
+		Joins("JOIN tag_tables ON tag_tables.id = problem_tag_tables.tag_id").
+		Where("problem_tag_tables.problem_id IN ?", problemIds).
+		Order("tag_tables.name").Rows()
+	if err != nil {
+		fmt.Println(err)
+		return tagNamesMap
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var problemId int
+		var name string
+		rows.Scan(&problemId, &name)
+
+		tagNamesMap[problemId] = append(tagNamesMap[problemId], name)
+	}
+
+	return tagNamesMap
+}
+
+// RFC 3339 or a plain YYYY-MM-DD date, endOfDay moves a plain date to the
+// start of the next day for exclusive upper bounds
+func parseTimeQuery(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return t, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+func getPagination(c *gin.Context) (page int, pageSize int, err error) {
+	page, err = strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil {
+		return
+	}
+	pageSize, err = strconv.Atoi(c.DefaultQuery("pageSize", strconv.Itoa(DEFAULT_PAGE_SIZE)))
+	if err != nil {
+		return
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > MAX_PAGE_SIZE {
+		pageSize = DEFAULT_PAGE_SIZE
+	}
+	return
+}
+
+func newUserAccount(user UserTable, roles []string) UserAccount {
+	return UserAccount{
+		Id:            user.Id,
+		Username:      user.Username,
+		Name:          user.Name,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		CreatedAt:     user.CreatedAt,
+		Disabled:      user.Disabled,
+		Roles:         roles,
+	}
+}
+
+// submissions to problems without testcases used to stay pending forever
+func migrateUnjudgeableSubmissions(tx *gorm.DB) error {
+	testCases := tx.Model(&TestCaseTable{}).Select("1").Where("test_case_tables.problem_id = submission_tables.problem_id")
+	result := tx.Model(&SubmissionTable{}).
+		Where("result = ? AND NOT EXISTS (?)", SUBMISSION_NO_RESULT, testCases).
+		Update("result", SUBMISSION_NOT_JUDGEABLE)
+	if result.RowsAffected > 0 {
+		fmt.Printf("marked %d pending submissions without testcases not judgeable\n", result.RowsAffected)
+	}
+	return result.Error
+}
+
+// owners may always access their submission, anyone else needs permission
+// and, with an api token, the admin scope
+func canAccessSubmission(c *gin.Context, submission SubmissionTable, permission string) bool {
+	if userId, _ := getCurrentUserId(c); userId == submission.UserId {
+		return true
+	}
+	return hasPermission(c, permission) && hasScope(c, SCOPE_PROBLEMS_ADMIN)
+}
+
+// respond with 429 and return false when the user has too many submissions
+// waiting for a verdict or submits too fast
+func checkSubmissionLimits(c *gin.Context, tx *gorm.DB, limiter *SubmissionLimiter, maxPending int, userId int) bool {
+	if maxPending > 0 {
+		var pending int64
+		tx.Model(&SubmissionTable{}).
+			Where("user_id = ? AND result = ? AND reference_solution_id = 0", userId, SUBMISSION_NO_RESULT).
+			Where("created_at > ?", time.Now().Add(-PENDING_SUBMISSION_MAX_AGE)).
+			Count(&pending)
+		if pending >= int64(maxPending) {
+			seconds := int(PENDING_SUBMISSIONS_RETRY_AFTER.Seconds())
+			c.Header("Retry-After", strconv.Itoa(seconds))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error":                 "too many submissions waiting for a verdict",
+				"maxPendingSubmissions": maxPending,
+				"retryAfter":            seconds,
+			})
+			return false
+		}
+	}
+
+	// the limiter fails open while Redis is unavailable
+	retryAfter, err := limiter.Take(c.Request.Context(), userId)
+	if err != nil {
+		fmt.Println(err)
+	}
+	if retryAfter > 0 {
+		seconds := int(math.Ceil(retryAfter.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(seconds))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many submissions", "retryAfter": seconds})
+		return false
+	}
+
+	return true
+}
+
+func newSubmission(submission SubmissionTable, problem ProblemTable) Submission {
+	return Submission{
+		Id:           submission.Id,
+		Language:     submission.Language,
+		Code:         submission.Code,
+		ExecutedTime: submission.ExecutedTime,
+		Result:       submission.Result,
+		ProblemId:    submission.ProblemId,
+		ProblemTitle: problem.Title,
+		UserId:       submission.UserId,
+		CreatedAt:    submission.CreatedAt,
+		Shared:       submission.ShareTokenHash != "",
+	}
+}
+
+func sendEmailVerification(tx *gorm.DB, mailer Mailer, baseURL string, user UserTable) error {
+	token, err := issueUserToken(tx, user, USER_TOKEN_EMAIL_VERIFICATION, EMAIL_VERIFICATION_TTL)
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Hi %s,\n\nplease confirm your email address by opening\n\n%s/verify-email?token=%s\n\n"+
+		"The link expires in %s.\n", user.Username, baseURL, token, EMAIL_VERIFICATION_TTL)
+	return mailer.Send(user.Email, "Confirm your email address", body)
+}
+
+func sendPasswordReset(tx *gorm.DB, mailer Mailer, baseURL string, user UserTable) error {
+	token, err := issueUserToken(tx, user, USER_TOKEN_PASSWORD_RESET, PASSWORD_RESET_TTL)
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Hi %s,\n\nsomeone asked to reset your password, open\n\n%s/reset-password?token=%s\n\n"+
+		"to choose a new one. The link expires in %s, ignore this mail if it wasn't you.\n",
+		user.Username, baseURL, token, PASSWORD_RESET_TTL)
+	return mailer.Send(user.Email, "Reset your password", body)
+}
+
+func main() {
+	config := loadConfig()
+	mailer := newMailer(config)
+
+	db, err := initDatabase()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	rdb := redis.NewClient(&redis.Options{})
+	defer rdb.Close()
+
+	// create tables
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.AutoMigrate(&SchemaMigrationTable{}); err != nil {
+			return err
+		}
+		// existing duplicates would keep the unique user indexes from being built
+		if err := runMigration(tx, "duplicate-users", migrateDuplicateUsers); err != nil {
+			return err
+		}
+
+		err := tx.AutoMigrate(&ProblemTable{}, &TestCaseTable{}, &UserTable{}, &SubmissionTable{},
+			&TagTable{}, &ProblemTagTable{}, &ProblemLanguageTable{},
+			&ProblemStatementTable{}, &ProblemAttachmentTable{}, &ProblemCollaboratorTable{},
+			&ProblemEditorialTable{}, &ReferenceSolutionTable{}, &ProblemToolTable{},
+			&ApiTokenTable{}, &RoleTable{}, &RolePermissionTable{}, &UserRoleTable{},
+			&UserTokenTable{}, &UserTotpTable{}, &RecoveryCodeTable{})
+		if err != nil {
+			return err
+		}
+
+		if err := seedRoles(tx); err != nil {
+			return err
+		}
+		if err := runMigration(tx, "authority-to-roles", migrateAuthorityToRoles); err != nil {
+			return err
+		}
+		return runMigration(tx, "unjudgeable-submissions", migrateUnjudgeableSubmissions)
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	r := gin.Default()
+	sessionStore := newSessionStore(rdb, config.SessionSecret, config.SessionMaxAge)
+	loginThrottle := newLoginThrottle(rdb)
+	leaderboard := newLeaderboard(rdb)
+	leaderboardWorker := newLeaderboardWorker(db, leaderboard)
+	submissionLimiter := newSubmissionLimiter(rdb, config.SubmissionBurst, config.SubmissionInterval)
+	r.Use(sessionStore.Middleware(), apiTokenAuthentication(db), loadPermissions(db))
+
+	go leaderboardWorker.Run()
+
+	// first start, or Redis lost its data
+	if count, err := leaderboard.Count(context.Background()); err == nil && count == 0 {
+		leaderboardWorker.Rebuild()
+	}
+
+	// scheduled publishing changes the ranking without any request
+	go func() {
+		for range time.Tick(LEADERBOARD_REBUILD_INTERVAL) {
+			leaderboardWorker.Rebuild()
+		}
+	}()
+
+	r.GET("/", func(c *gin.Context) {
+		c.String(200, "Hello, Jimmy_kiet.")
+	})
+
+	// group: problems
+	getProblemsHandler := func(c *gin.Context) {
+		var problems []problemsMap
+
+		// optional filters: ?tag=dp&minDifficulty=800&maxDifficulty=1600
+		tag := c.Query("tag")
+		minDifficulty, err := strconv.Atoi(c.DefaultQuery("minDifficulty", "0"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get minDifficulty err: %s", err.Error()))
+			return
+		}
+		maxDifficulty, err := strconv.Atoi(c.DefaultQuery("maxDifficulty", strconv.Itoa(MAX_PROBLEM_DIFFICULTY)))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get maxDifficulty err: %s", err.Error()))
+			return
+		}
+
+		// admins see every problem and may filter by ?visibility=draft,
+		// collaborators also see their own unpublished problems
+		superUser := canManageProblems(c)
+		userId, _ := getCurrentUserId(c)
+		if !hasScope(c, SCOPE_PROBLEMS_ADMIN) {
+			userId = 0
+		}
+		visibility := c.Query("visibility")
+
+		db.Transaction(func(tx *gorm.DB) error {
+			// do some database operations in the transaction (use 'tx' from this point, not 'db')
+			query := tx.Model(&ProblemTable{}).Where("difficulty BETWEEN ? AND ?", minDifficulty, maxDifficulty)
+			if !superUser {
+				query = query.Where(visibleProblemsCondition(tx, time.Now()).Or("problem_tables.id IN (?)",
+					tx.Model(&ProblemCollaboratorTable{}).Select("problem_id").Where("user_id = ?", userId)))
+			} else if visibility != "" {
+				query = query.Where("visibility = ?", visibility)
+			}
+			if tag != "" {
+				query = query.Where("id IN (?)", tx.Table("problem_tag_tables").
+					Select("problem_tag_tables.problem_id").
+					Joins("JOIN tag_tables ON tag_tables.id = problem_tag_tables.tag_id").
+					Where("tag_tables.name = ?", tag))
+			}
+
+			rows, err := query.Order("id").Rows()
+			if err != nil {
+				fmt.Println(err)
+				return err
+			}
+			defer rows.Close()
+
+			var problemIds []int
+			for rows.Next() {
+				var problem ProblemTable
+				// ScanRows is a method of `gorm.DB`, it can be used to scan a row into a struct
+				tx.ScanRows(rows, &problem)
+
+				// do something
+				temp := problemsMap{
+					"id":         strconv.Itoa(problem.Id),
+					"title":      problem.Title,
+					"difficulty": problem.Difficulty,
+					"visibility": problem.Visibility,
+				}
+				problems = append(problems, temp)
+				problemIds = append(problemIds, problem.Id)
+			}
+
+			tagNamesMap := getProblemTagNamesMap(tx, problemIds)
+			for i, problemId := range problemIds {
+				problems[i]["tags"] = tagNamesMap[problemId]
+			}
+
+			// return nil will commit the whole transaction
+			return nil
+		})
+
+		c.JSON(http.StatusOK, gin.H{
+			"data": problems,
+		})
+	}
+
+	createProblemHandler := func(c *gin.Context) {
+		var newProblemDTO ProblemPostDTO
+		var newProblem ProblemTable
+		var newProblemId int
+
+		userId, _ := getCurrentUserId(c)
+
+		err := c.Bind(&newProblemDTO)
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("create problem err: %s", err.Error()))
+			return
+		}
+		if newProblemDTO.Difficulty < 0 || newProblemDTO.Difficulty > MAX_PROBLEM_DIFFICULTY {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "difficulty out of range"})
+			return
+		}
+		// new problems stay invisible until they are explicitly published
+		if newProblemDTO.Visibility == "" {
+			newProblemDTO.Visibility = PROBLEM_DRAFT
+		}
+		if !isValidProblemVisibility(newProblemDTO.Visibility) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid visibility"})
+			return
+		}
+		err = validateProblemLimits(newProblemDTO.TimeLimitSeconds, newProblemDTO.MemoryLimitMB,
+			newProblemDTO.OutputLimitKB, newProblemDTO.SourceLimitKB, newProblemDTO.Languages)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		newProblem = ProblemTable{
+			Title:       newProblemDTO.Title,
+			Description: newProblemDTO.Description,
+			Difficulty:  newProblemDTO.Difficulty,
+			Visibility:  newProblemDTO.Visibility,
+			PublishAt:   newProblemDTO.PublishAt,
+			CreatorId:   userId,
+
+			TimeLimitSeconds: newProblemDTO.TimeLimitSeconds,
+			MemoryLimitMB:    newProblemDTO.MemoryLimitMB,
+			OutputLimitKB:    newProblemDTO.OutputLimitKB,
+			SourceLimitKB:    newProblemDTO.SourceLimitKB,
+		}
+
+		tagError := false
+		err = db.Transaction(func(tx *gorm.DB) error {
+			tags, err := findTagsByNames(tx, newProblemDTO.Tags)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				tagError = true
+				return err
+			}
+
+			if err := tx.Create(&newProblem).Error; err != nil {
+				fmt.Println(err)
+				return err
+			}
+			newProblemId = newProblem.Id
+
+			// the creator owns the problem
+			owner := ProblemCollaboratorTable{Role: PROBLEM_ROLE_OWNER, ProblemId: newProblemId, UserId: userId}
+			if err := tx.Create(&owner).Error; err != nil {
+				fmt.Println(err)
+				return err
+			}
+
+			if err := setProblemTags(tx, newProblemId, tags); err != nil {
+				fmt.Println(err)
+				return err
+			}
+			if err := setProblemLanguages(tx, newProblemId, newProblemDTO.Languages); err != nil {
+				fmt.Println(err)
+				return err
+			}
+
+			for _, TestCase := range newProblemDTO.TestCases {
+				tempTestCase := TestCaseTable{
+					Input:          TestCase.Input,
+					GeneratorArgs:  TestCase.GeneratorArgs,
+					ExpectedOutput: TestCase.ExpectedOutput,
+					Comment:        TestCase.Comment,
+					Score:          TestCase.Score,
+					TimeOutSeconds: TestCase.TimeOutSeconds,
+					ProblemId:      newProblemId,
+				}
+				if err := tx.Create(&tempTestCase).Error; err != nil {
+					fmt.Println(err)
+					return err
+				}
+			}
+
+			return nil
+		})
+		if tagError {
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create problem"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"problem_id": newProblemId,
+		})
+	}
+
+	getProblemByIDHandler := func(c *gin.Context) {
+		problemId, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get problem Id err: %s", err.Error()))
+			return
+		}
+
+		var responseData Problem
+		var requesetProblem ProblemTable
+		matchError := false
+		db.Transaction(func(tx *gorm.DB) error {
+			tx.First(&requesetProblem, problemId)
+			if requesetProblem.Id == 0 || (!isProblemVisible(requesetProblem, time.Now()) &&
+				!hasProblemRole(c, tx, problemId, PROBLEM_ROLE_VIEWER)) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "problem not found"})
+				matchError = true
+				return nil
+			}
+
+			var problemLanguages []ProblemLanguageTable
+			tx.Where("problem_id = ?", problemId).Order("id").Find(&problemLanguages)
+			var languages []ProblemLanguageDTO
+			for _, l := range problemLanguages {
+				languages = append(languages, ProblemLanguageDTO{Language: l.Language, TimeMultiplier: l.TimeMultiplier})
+			}
+
+			var statements []ProblemStatementTable
+			tx.Where("problem_id = ?", problemId).Order("id").Find(&statements)
+			var statementLanguages []string
+			for _, statement := range statements {
+				statementLanguages = append(statementLanguages, statement.Language)
+			}
+
+			var problemAttachments []ProblemAttachmentTable
+			tx.Where("problem_id = ?", problemId).Order("id").Find(&problemAttachments)
+			var attachments []ProblemAttachment
+			for _, attachment := range problemAttachments {
+				attachments = append(attachments, newProblemAttachment(attachment))
+			}
+
+			// testcases are hidden data, only collaborators see them
+			var requestTestcases []TestCase
+			if hasProblemRole(c, tx, problemId, PROBLEM_ROLE_VIEWER) {
+				var testcases []TestCaseTable
+				if err := tx.Where("problem_id = ?", problemId).Order("id").Find(&testcases).Error; err != nil {
+					fmt.Println(err)
+					return err
+				}
+
+				for _, testcase := range testcases {
+					temp := TestCase{
+						Id:             strconv.Itoa(testcase.Id),
+						Input:          testcase.Input,
+						GeneratorArgs:  testcase.GeneratorArgs,
+						ExpectedOutput: testcase.ExpectedOutput,
+						Comment:        testcase.Comment,
+						Score:          testcase.Score,
+						TimeOutSeconds: testcase.TimeOutSeconds,
+					}
+
+					requestTestcases = append(requestTestcases, temp)
+				}
+			}
+
+			responseData = Problem{
+				Id:          strconv.Itoa(requesetProblem.Id),
+				Title:       requesetProblem.Title,
+				Description: requesetProblem.Description,
+				Difficulty:  requesetProblem.Difficulty,
+				Tags:        getProblemTagNamesMap(tx, []int{problemId})[problemId],
+				Visibility:  requesetProblem.Visibility,
+				PublishAt:   requesetProblem.PublishAt,
+				CreatorId:   requesetProblem.CreatorId,
+
+				TimeLimitSeconds: requesetProblem.TimeLimitSeconds,
+				MemoryLimitMB:    requesetProblem.MemoryLimitMB,
+				OutputLimitKB:    requesetProblem.OutputLimitKB,
+				SourceLimitKB:    requesetProblem.SourceLimitKB,
+				Languages:        languages,
+
+				Statement:          selectProblemStatement(c, statements),
+				StatementLanguages: statementLanguages,
+				Attachments:        attachments,
+
+				TestCases: requestTestcases,
+			}
+
+			return nil
+		})
+		if matchError {
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data": responseData,
+		})
+	}
+
+	/* three cases
+	1. use map to record new testcases
+	2. iterate on old testcases
+	2-1. if cur testcase not in new testcases set, <delete cur testcase>
+	3. iterate on new testcases
+	3-1. if cur testcase id is empty(string -> ""), <create cur testcase>
+	3-2. else, <update cur testcase>
+	*/
+	updateProblemByIDHandler := func(c *gin.Context) {
+		problemId, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get problem Id err: %s", err.Error()))
+			return
+		}
+
+		var updatedProblem ProblemPutDTO
+		err = c.Bind(&updatedProblem)
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("update problem err: %s", err.Error()))
+			return
+		}
+		if updatedProblem.Difficulty != nil &&
+			(*updatedProblem.Difficulty < 0 || *updatedProblem.Difficulty > MAX_PROBLEM_DIFFICULTY) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "difficulty out of range"})
+			return
+		}
+		if updatedProblem.Visibility != "" && !isValidProblemVisibility(updatedProblem.Visibility) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid visibility"})
+			return
+		}
+		timeLimitSeconds, memoryLimitMB, outputLimitKB, sourceLimitKB := problemPutLimits(updatedProblem)
+		err = validateProblemLimits(timeLimitSeconds, memoryLimitMB, outputLimitKB, sourceLimitKB, updatedProblem.Languages)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// nothing is validated for a problem that doesn't exist
+		var problemCount int64
+		db.Model(&ProblemTable{}).Where("id = ?", problemId).Count(&problemCount)
+		if problemCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "problem not found"})
+			return
+		}
+
+		// the problem validator has to accept every hand-written input before anything is saved,
+		// generated inputs are validated when they are regenerated
+		var inputs []string
+		var inputIndexes []int
+		for i, t := range updatedProblem.TestCases {
+			if t.GeneratorArgs == "" {
+				inputs = append(inputs, t.Input)
+				inputIndexes = append(inputIndexes, i)
+			}
+		}
+		validationErrors, err := validateTestCaseInputs(db, rdb, problemId, inputs, config.ToolRunTimeout)
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "validator is unavailable"})
+			return
+		}
+		if validationErrors != nil {
+			for i := range validationErrors {
+				validationErrors[i].Index = inputIndexes[validationErrors[i].Index]
+			}
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error":   "validator rejected testcase inputs",
+				"details": validationErrors,
+			})
+			return
+		}
+
+		// record new testcases
+		newTestcasesMap := map[string]TestCasePutDTO{}
+		for _, t := range updatedProblem.TestCases {
+			if t.Id != "" {
+				newTestcasesMap[t.Id] = t
+			}
+		}
+
+		tagError := false
+		matchError := false
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var problem ProblemTable
+			tx.First(&problem, problemId)
+			if problem.Id == 0 {
+				c.JSON(http.StatusNotFound, gin.H{"error": "problem not found"})
+				matchError = true
+				return nil
+			}
+
+			// update Problem details, empty fields are kept
+			err := tx.Model(&ProblemTable{Id: problemId}).Updates(
+				ProblemTable{
+					Title:       updatedProblem.Title,
+					Description: updatedProblem.Description,
+				}).Error
+			if err != nil {
+				fmt.Println(err)
+				return err
+			}
+
+			// a struct update would skip 0, which marks the problem unrated
+			if updatedProblem.Difficulty != nil {
+				err := tx.Model(&ProblemTable{Id: problemId}).Update("difficulty", *updatedProblem.Difficulty).Error
+				if err != nil {
+					fmt.Println(err)
+					return err
+				}
+			}
+
+			// visibility and publishAt are updated together, a null publishAt releases immediately
+			if updatedProblem.Visibility != "" {
+				err := tx.Model(&ProblemTable{Id: problemId}).Select("visibility", "publish_at").Updates(
+					ProblemTable{Visibility: updatedProblem.Visibility, PublishAt: updatedProblem.PublishAt}).Error
+				if err != nil {
+					fmt.Println(err)
+					return err
+				}
+			}
+
+			// only the limits that were sent are replaced, 0 removes a limit
+			if limitUpdates := problemLimitUpdates(updatedProblem); len(limitUpdates) > 0 {
+				if err := tx.Model(&ProblemTable{Id: problemId}).Updates(limitUpdates).Error; err != nil {
+					fmt.Println(err)
+					return err
+				}
+			}
+
+			// languages are only replaced when the field is present
+			if updatedProblem.Languages != nil {
+				if err := setProblemLanguages(tx, problemId, updatedProblem.Languages); err != nil {
+					fmt.Println(err)
+					return err
+				}
+			}
+
+			// tags are only replaced when the field is present
+			if updatedProblem.Tags != nil {
+				tags, err := findTagsByNames(tx, updatedProblem.Tags)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					tagError = true
+					return err
+				}
+
+				if err := setProblemTags(tx, problemId, tags); err != nil {
+					fmt.Println(err)
+					return err
+				}
+			}
+
+			var existingTestcases []TestCaseTable
+			if err := tx.Where("problem_id = ?", problemId).Find(&existingTestcases).Error; err != nil {
+				fmt.Println(err)
+				return err
+			}
+
+			// delete cur testcase
+			var deletedTestcases []TestCasePutDTO
+			for _, testcase := range existingTestcases {
+				_, ok := newTestcasesMap[strconv.Itoa(testcase.Id)]
+				temp := TestCasePutDTO{
+					Id: strconv.Itoa(testcase.Id),
+				}
+
+				if !ok {
+					deletedTestcases = append(deletedTestcases, temp)
+				}
+			}
+			for _, deletedTestcase := range deletedTestcases {
+				deletedId, err := strconv.Atoi(deletedTestcase.Id)
+				if err != nil {
+					fmt.Println("delete error")
+					return err
+				}
+
+				if err := tx.Delete(&TestCaseTable{Id: deletedId}).Error; err != nil {
+					fmt.Println(err)
+					return err
+				}
+			}
+
+			// create & update cur testcase
+			for _, t := range updatedProblem.TestCases {
+				if t.Id == "" {
+					testcase := TestCaseTable{
+						Input:          t.Input,
+						GeneratorArgs:  t.GeneratorArgs,
+						ExpectedOutput: t.ExpectedOutput,
+						Comment:        t.Comment,
+						Score:          t.Score,
+						TimeOutSeconds: t.TimeOutSeconds,
+						ProblemId:      problemId,
+					}
+
+					if err := tx.Create(&testcase).Error; err != nil {
+						fmt.Println(err)
+						return err
+					}
+				} else {
+					updatedId, err := strconv.Atoi(t.Id)
+					if err != nil {
+						fmt.Println("update error")
+						return err
+					}
+
+					// ids of other problems' testcases match nothing
+					err = tx.Model(&TestCaseTable{Id: updatedId}).Where("problem_id = ?", problemId).Updates(
+						TestCaseTable{
+							Input:          t.Input,
+							GeneratorArgs:  t.GeneratorArgs,
+							ExpectedOutput: t.ExpectedOutput,
+							Comment:        t.Comment,
+							Score:          t.Score,
+							TimeOutSeconds: t.TimeOutSeconds,
+						}).Error
+					if err != nil {
+						fmt.Println(err)
+						return err
+					}
+				}
+			}
+
+			return nil
+		})
+		if tagError || matchError {
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update problem"})
+			return
+		}
+		// visibility and difficulty decide what a solved problem is worth
+		if updatedProblem.Visibility != "" || updatedProblem.Difficulty != nil {
+			leaderboardWorker.Rebuild()
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"Ok": true,
+		})
+	}
+
+	deleteProblemByIDHandler := func(c *gin.Context) {
+		problemId, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get problem Id err: %s", err.Error()))
+			return
+		}
+
+		// soft delete, testcases and submissions are kept so the problem can be restored
+		matchError := false
+		err = db.Transaction(func(tx *gorm.DB) error {
+			result := tx.Delete(&ProblemTable{}, problemId)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				c.JSON(http.StatusNotFound, gin.H{"error": "problem not found"})
+				matchError = true
+			}
+
+			return nil
+		})
+		if matchError {
+			return
+		}
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete problem"})
+			return
+		}
+		leaderboardWorker.Rebuild()
+
+		c.JSON(http.StatusOK, gin.H{
+			"Ok": true,
+		})
+	}
+
+	getDeletedProblemsHandler := func(c *gin.Context) {
+		var problems []problemsMap
+
+		db.Transaction(func(tx *gorm.DB) error {
+			var deletedProblems []ProblemTable
+			tx.Unscoped().Where("deleted_at IS NOT NULL").Order("deleted_at").Find(&deletedProblems)
+
+			for _, problem := range deletedProblems {
+				temp := problemsMap{
+					"id":          strconv.Itoa(problem.Id),
+					"title":       problem.Title,
+					"deletedAt":   problem.DeletedAt.Time,
+					"purgeableAt": problem.DeletedAt.Time.Add(PROBLEM_RETENTION),
+				}
+				problems = append(problems, temp)
+			}
+
+			return nil
+		})
+
+		c.JSON(http.StatusOK, gin.H{
+			"data": problems,
+		})
+	}
+
+	restoreProblemByIDHandler := func(c *gin.Context) {
+		problemId, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get problem Id err: %s", err.Error()))
+			return
+		}
+
+		matchError := false
+		db.Transaction(func(tx *gorm.DB) error {
+			result := tx.Unscoped().Model(&ProblemTable{}).
+				Where("id = ? AND deleted_at IS NOT NULL", problemId).Update("deleted_at", nil)
+			if result.RowsAffected == 0 {
+				c.JSON(http.StatusNotFound, gin.H{"error": "problem not found in trash"})
+				matchError = true
+				return nil
+			}
+
+			return result.Error
+		})
+		if matchError {
+			return
+		}
+		leaderboardWorker.Rebuild()
+
+		c.JSON(http.StatusOK, gin.H{
+			"Ok": true,
+		})
+	}
+
+	purgeProblemByIDHandler := func(c *gin.Context) {
+		problemId, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get problem Id err: %s", err.Error()))
+			return
+		}
+
+		matchError := false
+		db.Transaction(func(tx *gorm.DB) error {
+			var problem ProblemTable
+			tx.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", problemId).Find(&problem)
+			if problem.Id == 0 {
+				c.JSON(http.StatusNotFound, gin.H{"error": "problem not found in trash"})
+				matchError = true
+				return nil
+			}
+
+			purgeableAt := problem.DeletedAt.Time.Add(PROBLEM_RETENTION)
+			if time.Now().Before(purgeableAt) {
+				c.JSON(http.StatusConflict, gin.H{
+					"error":       "problem is still in its retention period",
+					"purgeableAt": purgeableAt,
+				})
+				matchError = true
+				return nil
+			}
+
+			return purgeProblem(tx, problemId)
+		})
+		if matchError {
+			return
+		}
+		removeProblemAttachmentFiles(problemId)
+		leaderboardWorker.Rebuild()
+
+		c.JSON(http.StatusOK, gin.H{
+			"Ok": true,
+		})
+	}
+
+	// purge every problem whose retention period is over
+	purgeDeletedProblemsHandler := func(c *gin.Context) {
+		var purgedProblemIds []int
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			tx.Unscoped().Model(&ProblemTable{}).
+				Where("deleted_at IS NOT NULL AND deleted_at <= ?", time.Now().Add(-PROBLEM_RETENTION)).
+				Pluck("id", &purgedProblemIds)
+
+			for _, problemId := range purgedProblemIds {
+				if err := purgeProblem(tx, problemId); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to purge problems"})
+			return
+		}
+
+		for _, problemId := range purgedProblemIds {
+			removeProblemAttachmentFiles(problemId)
+		}
+		if purgedProblemIds != nil {
+			leaderboardWorker.Rebuild()
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data": purgedProblemIds,
+		})
+	}
+
+	putProblemStatementHandler := func(c *gin.Context) {
+		problemId, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get problem Id err: %s", err.Error()))
+			return
+		}
+		tag, err := language.Parse(c.Param("lang"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get statement language err: %s", err.Error()))
+			return
+		}
+
+		var statementDTO ProblemStatementPutDTO
+		err = c.Bind(&statementDTO)
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("update statement err: %s", err.Error()))
+			return
+		}
+
+		statement := ProblemStatementTable{
+			Language:     tag.String(),
+			Title:        statementDTO.Title,
+			Legend:       statementDTO.Legend,
+			InputFormat:  statementDTO.InputFormat,
+			OutputFormat: statementDTO.OutputFormat,
+			Notes:        statementDTO.Notes,
+			ProblemId:    problemId,
+		}
+		if err := renderProblemStatement(&statement); err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("render statement err: %s", err.Error()))
+			return
+		}
+
+		matchError := false
+		db.Transaction(func(tx *gorm.DB) error {
+			var problem ProblemTable
+			tx.First(&problem, problemId)
+			if problem.Id == 0 {
+				c.JSON(http.StatusNotFound, gin.H{"error": "problem not found"})
+				matchError = true
+				return nil
+			}
+
+			// one statement per language, replace the old one
+			var oldStatement ProblemStatementTable
+			tx.Where("problem_id = ? AND language = ?", problemId, statement.Language).Find(&oldStatement)
+			statement.Id = oldStatement.Id
+
+			return tx.Save(&statement).Error
+		})
+		if matchError {
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data": newProblemStatement(statement),
+		})
+	}
+
+	deleteProblemStatementHandler := func(c *gin.Context) {
+		problemId, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get problem Id err: %s", err.Error()))
+			return
+		}
+		tag, err := language.Parse(c.Param("lang"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get statement language err: %s", err.Error()))
+			return
+		}
+
+		db.Transaction(func(tx *gorm.DB) error {
+			tx.Where("problem_id = ? AND language = ?", problemId, tag.String()).Delete(&ProblemStatementTable{})
+
+			return nil
+		})
+
+		c.JSON(http.StatusOK, gin.H{
+			"Ok": true,
+		})
+	}
+
+	createProblemAttachmentHandler := func(c *gin.Context) {
+		problemId, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get problem Id err: %s", err.Error()))
+			return
+		}
+
+		file, err := c.FormFile("file")
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get attachment err: %s", err.Error()))
+			return
+		}
+		if file.Size > MAX_ATTACHMENT_SIZE {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "attachment is too large"})
+			return
+		}
+
+		var problem ProblemTable
+		db.First(&problem, problemId)
+		if problem.Id == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "problem not found"})
+			return
+		}
+
+		// random prefix keeps attachments of unpublished problems unguessable
+		prefix, err := randomHex(16)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save attachment"})
+			return
+		}
+		fileName := filepath.Base(file.Filename)
+		path := strconv.Itoa(problemId) + "/" + prefix + "-" + attachmentNamePattern.ReplaceAllString(fileName, "_")
+		if err := c.SaveUploadedFile(file, filepath.Join(ATTACHMENT_DIR, path)); err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save attachment"})
+			return
+		}
+
+		attachment := ProblemAttachmentTable{
+			FileName:    fileName,
+			ContentType: file.Header.Get("Content-Type"),
+			Size:        file.Size,
+			Path:        path,
+			ProblemId:   problemId,
+		}
+		if err := db.Create(&attachment).Error; err != nil {
+			fmt.Println(err)
+			os.Remove(filepath.Join(ATTACHMENT_DIR, path))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save attachment"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data": newProblemAttachment(attachment),
+		})
+	}
+
+	deleteProblemAttachmentHandler := func(c *gin.Context) {
+		problemId, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get problem Id err: %s", err.Error()))
+			return
+		}
+		attachmentId, err := strconv.Atoi(c.Param("attachmentId"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get attachment Id err: %s", err.Error()))
+			return
+		}
+
+		var attachment ProblemAttachmentTable
+		db.Where("id = ? AND problem_id = ?", attachmentId, problemId).Find(&attachment)
+		if attachment.Id == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "attachment not found"})
+			return
+		}
+
+		db.Delete(&attachment)
+		if err := os.Remove(filepath.Join(ATTACHMENT_DIR, attachment.Path)); err != nil {
+			fmt.Println(err)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"Ok": true,
+		})
+	}
+
+	// attachments of unpublished problems stay private, and uploads are always
+	// downloaded so an html or svg file can't run scripts on the api's origin
+	getProblemAttachmentFileHandler := func(c *gin.Context) {
+		problemId, err := strconv.Atoi(c.Param("problemId"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get problem Id err: %s", err.Error()))
+			return
+		}
+
+		var attachment ProblemAttachmentTable
+		db.Where("problem_id = ? AND path = ?", problemId, strconv.Itoa(problemId)+"/"+c.Param("fileName")).
+			Find(&attachment)
+		var problem ProblemTable
+		if attachment.Id != 0 {
+			db.First(&problem, problemId)
+		}
+		if problem.Id == 0 || (!isProblemVisible(problem, time.Now()) &&
+			!hasProblemRole(c, db, problemId, PROBLEM_ROLE_VIEWER)) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "attachment not found"})
+			return
+		}
+
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.FileAttachment(filepath.Join(ATTACHMENT_DIR, attachment.Path),
+			attachmentNamePattern.ReplaceAllString(attachment.FileName, "_"))
+	}
+
+	r.GET("/attachments/:problemId/:fileName", getProblemAttachmentFileHandler)
+
+	getProblemCollaboratorsHandler := func(c *gin.Context) {
+		problemId, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get problem Id err: %s", err.Error()))
+			return
+		}
+
+		var collaborators []ProblemCollaborator
+		db.Transaction(func(tx *gorm.DB) error {
+			return tx.Model(&ProblemCollaboratorTable{}).
+				Select("problem_collaborator_tables.user_id, user_tables.username, problem_collaborator_tables.role").
+				Joins("JOIN user_tables ON user_tables.id = problem_collaborator_tables.user_id").
+				Where("problem_collaborator_tables.problem_id = ?", problemId).
+				Order("problem_collaborator_tables.id").
+				Scan(&collaborators).Error
+		})
+
+		c.JSON(http.StatusOK, gin.H{
+			"data": collaborators,
+		})
+	}
+
+	putProblemCollaboratorHandler := func(c *gin.Context) {
+		problemId, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get problem Id err: %s", err.Error()))
+			return
+		}
+		userId, err := strconv.Atoi(c.Param("userId"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get user Id err: %s", err.Error()))
+			return
+		}
+
+		var collaboratorDTO ProblemCollaboratorPutDTO
+		err = c.Bind(&collaboratorDTO)
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("update collaborator err: %s", err.Error()))
+			return
+		}
+		if problemRoleLevel(collaboratorDTO.Role) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid role"})
+			return
+		}
+
+		matchError := false
+		db.Transaction(func(tx *gorm.DB) error {
+			var user UserTable
+			tx.First(&user, userId)
+			if user.Id == 0 {
+				c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+				matchError = true
+				return nil
+			}
+
+			var collaborator ProblemCollaboratorTable
+			tx.Where("problem_id = ? AND user_id = ?", problemId, userId).Find(&collaborator)
+
+			// a problem always keeps at least one owner
+			if collaborator.Role == PROBLEM_ROLE_OWNER && collaboratorDTO.Role != PROBLEM_ROLE_OWNER {
+				var owners int64
+				tx.Model(&ProblemCollaboratorTable{}).Where("problem_id = ? AND role = ?", problemId, PROBLEM_ROLE_OWNER).Count(&owners)
+				if owners <= 1 {
+					c.JSON(http.StatusConflict, gin.H{"error": "problem must have an owner"})
+					matchError = true
+					return nil
+				}
+			}
+
+			collaborator.ProblemId = problemId
+			collaborator.UserId = userId
+			collaborator.Role = collaboratorDTO.Role
+			return tx.Save(&collaborator).Error
+		})
+		if matchError {
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"Ok": true,
+		})
+	}
+
+	deleteProblemCollaboratorHandler := func(c *gin.Context) {
+		problemId, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get problem Id err: %s", err.Error()))
+			return
+		}
+		userId, err := strconv.Atoi(c.Param("userId"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get user Id err: %s", err.Error()))
+			return
+		}
+
+		matchError := false
+		db.Transaction(func(tx *gorm.DB) error {
+			if getProblemRole(tx, problemId, userId) == PROBLEM_ROLE_OWNER {
+				var owners int64
+				tx.Model(&ProblemCollaboratorTable{}).Where("problem_id = ? AND role = ?", problemId, PROBLEM_ROLE_OWNER).Count(&owners)
+				if owners <= 1 {
+					c.JSON(http.StatusConflict, gin.H{"error": "problem must have an owner"})
+					matchError = true
+					return nil
+				}
+			}
+
+			tx.Where("problem_id = ? AND user_id = ?", problemId, userId).Delete(&ProblemCollaboratorTable{})
+
+			return nil
+		})
+		if matchError {
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"Ok": true,
+		})
+	}
+
+	getProblemStatsHandler := func(c *gin.Context) {
+		problemId, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get problem Id err: %s", err.Error()))
+			return
+		}
+
+		var problem ProblemTable
+		db.First(&problem, problemId)
+		if problem.Id == 0 || (!isProblemVisible(problem, time.Now()) &&
+			!hasProblemRole(c, db, problemId, PROBLEM_ROLE_VIEWER)) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "problem not found"})
+			return
+		}
+
+		ctx := context.Background()
+		redisOK := getConnection(rdb) == nil
+		if redisOK {
+			cached, err := rdb.Get(ctx, problemStatsKey(problemId)).Bytes()
+			if err == nil {
+				var stats ProblemStats
+				if err := json.Unmarshal(cached, &stats); err == nil {
+					c.JSON(http.StatusOK, gin.H{
+						"data": stats,
+					})
+					return
+				}
+			}
+		}
+
+		var stats ProblemStats
+		err = db.Transaction(func(tx *gorm.DB) error {
+			stats, err = computeProblemStats(tx, problemId)
+			return err
+		})
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute stats"})
+			return
+		}
+
+		// the stats are served uncached when they can't be stored
+		if redisOK {
+			bytes, err := json.Marshal(stats)
+			if err != nil {
+				fmt.Println(err)
+			} else if err := rdb.Set(ctx, problemStatsKey(problemId), bytes, PROBLEM_STATS_CACHE_TTL).Err(); err != nil {
+				fmt.Println(err)
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data": stats,
+		})
+	}
+
+	// editorial and reference solutions are visible to collaborators, to users who
+	// solved the problem, and to everyone once an admin unlocks them
+	getProblemEditorialHandler := func(c *gin.Context) {
+		problemId, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get problem Id err: %s", err.Error()))
+			return
+		}
+
+		var problem ProblemTable
+		db.First(&problem, problemId)
+		isCollaborator := problem.Id != 0 && hasProblemRole(c, db, problemId, PROBLEM_ROLE_VIEWER)
+		if problem.Id == 0 || (!isProblemVisible(problem, time.Now()) && !isCollaborator) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "problem not found"})
+			return
+		}
+
+		canView := problem.EditorialUnlocked || isCollaborator
+		if userId, ok := getCurrentUserId(c); ok && !canView {
+			var accepted int64
+			db.Model(&SubmissionTable{}).
+				Where("problem_id = ? AND user_id = ? AND result = ? AND reference_solution_id = 0",
+					problemId, userId, SUBMISSION_ACCEPTED).
+				Count(&accepted)
+			canView = accepted > 0
+		}
+		if !canView {
+			c.JSON(http.StatusForbidden, gin.H{"error": "editorial is locked until the problem is solved"})
+			return
+		}
+
+		var responseData ProblemEditorial
+		db.Transaction(func(tx *gorm.DB) error {
+			var editorial ProblemEditorialTable
+			tx.Where("problem_id = ?", problemId).Find(&editorial)
+
+			var solutions []ReferenceSolutionTable
+			tx.Where("problem_id = ?", problemId).Order("id").Find(&solutions)
+
+			responseData = ProblemEditorial{
+				Content:     editorial.Content,
+				ContentHTML: editorial.ContentHTML,
+			}
+			for _, solution := range solutions {
+				responseData.ReferenceSolutions = append(responseData.ReferenceSolutions, ReferenceSolution{
+					Id:             strconv.Itoa(solution.Id),
+					Name:           solution.Name,
+					Language:       solution.Language,
+					Code:           solution.Code,
+					ExpectedResult: solution.ExpectedResult,
+				})
+			}
+
+			return nil
+		})
+
+		c.JSON(http.StatusOK, gin.H{
+			"data": responseData,
+		})
+	}
+
+	putProblemEditorialHandler := func(c *gin.Context) {
+		problemId, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get problem Id err: %s", err.Error()))
+			return
+		}
+
+		var editorialDTO ProblemEditorialPutDTO
+		err = c.Bind(&editorialDTO)
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("update editorial err: %s", err.Error()))
+			return
+		}
+
+		contentHTML, err := renderMarkdown(editorialDTO.Content)
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("render editorial err: %s", err.Error()))
+			return
+		}
+
+		matchError := false
+		db.Transaction(func(tx *gorm.DB) error {
+			var problem ProblemTable
+			tx.First(&problem, problemId)
+			if problem.Id == 0 {
+				c.JSON(http.StatusNotFound, gin.H{"error": "problem not found"})
+				matchError = true
+				return nil
+			}
+
+			var editorial ProblemEditorialTable
+			tx.Where("problem_id = ?", problemId).Find(&editorial)
+			editorial.ProblemId = problemId
+			editorial.Content = editorialDTO.Content
+			editorial.ContentHTML = contentHTML
+
+			return tx.Save(&editorial).Error
+		})
+		if matchError {
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"Ok": true,
+		})
+	}
+
+	unlockProblemEditorialHandler := func(c *gin.Context) {
+		problemId, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get problem Id err: %s", err.Error()))
+			return
+		}
+
+		var unlockDTO ProblemEditorialUnlockDTO
+		err = c.Bind(&unlockDTO)
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("unlock editorial err: %s", err.Error()))
+			return
+		}
+
+		result := db.Model(&ProblemTable{Id: problemId}).Update("editorial_unlocked", unlockDTO.Unlocked)
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "problem not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"Ok": true,
+		})
+	}
+
+	createReferenceSolutionHandler := func(c *gin.Context) {
+		problemId, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get problem Id err: %s", err.Error()))
+			return
+		}
+
+		var solutionDTO ReferenceSolutionPostDTO
+		err = c.Bind(&solutionDTO)
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("create reference solution err: %s", err.Error()))
+			return
+		}
+		if solutionDTO.Language == "" || solutionDTO.ExpectedResult == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "language and expectedResult are required"})
+			return
+		}
+
+		solution := ReferenceSolutionTable{
+			Name:           solutionDTO.Name,
+			Language:       solutionDTO.Language,
+			Code:           solutionDTO.Code,
+			ExpectedResult: solutionDTO.ExpectedResult,
+			ProblemId:      problemId,
+		}
+
+		matchError := false
+		db.Transaction(func(tx *gorm.DB) error {
+			var problem ProblemTable
+			tx.First(&problem, problemId)
+			if problem.Id == 0 {
+				c.JSON(http.StatusNotFound, gin.H{"error": "problem not found"})
+				matchError = true
+				return nil
+			}
+
+			return tx.Create(&solution).Error
+		})
+		if matchError {
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"reference_solution_id": solution.Id,
+		})
+	}
+
+	deleteReferenceSolutionHandler := func(c *gin.Context) {
+		problemId, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get problem Id err: %s", err.Error()))
+			return
+		}
+		solutionId, err := strconv.Atoi(c.Param("solutionId"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get reference solution Id err: %s", err.Error()))
+			return
+		}
+
+		db.Transaction(func(tx *gorm.DB) error {
+			tx.Where("id = ? AND problem_id = ?", solutionId, problemId).Delete(&ReferenceSolutionTable{})
+
+			return nil
+		})
+
+		c.JSON(http.StatusOK, gin.H{
+			"Ok": true,
+		})
+	}
+
+	// run every reference solution through the judge, results are read from
+	// GET /problems/:id/validation once the judger has reported them
+	validateProblemHandler := func(c *gin.Context) {
+		problemId, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get problem Id err: %s", err.Error()))
+			return
+		}
+		userId, _ := getCurrentUserId(c)
+
+		var judgerSubmissionDataList []JudgerSubmissionData
+		matchError := false
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var problem ProblemTable
+			tx.First(&problem, problemId)
+			if problem.Id == 0 {
+				c.JSON(http.StatusNotFound, gin.H{"error": "problem not found"})
+				matchError = true
+				return nil
+			}
+
+			var solutions []ReferenceSolutionTable
+			tx.Where("problem_id = ?", problemId).Order("id").Find(&solutions)
+			if len(solutions) == 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "problem has no reference solutions"})
+				matchError = true
+				return nil
+			}
+
+			// without testcases the runs can't be judged, they are not left pending
+			var testCaseCount int64
+			tx.Model(&TestCaseTable{}).Where("problem_id = ?", problemId).Count(&testCaseCount)
+			result := SUBMISSION_NO_RESULT
+			if testCaseCount == 0 {
+				result = SUBMISSION_NOT_JUDGEABLE
+			}
+
+			for _, solution := range solutions {
+				submission := SubmissionTable{
+					Language:     solution.Language,
+					Code:         solution.Code,
+					ExecutedTime: -1.0,
+					Result:       result,
+
+					ProblemId:           problemId,
+					UserId:              userId,
+					ReferenceSolutionId: solution.Id,
+				}
+				if testCaseCount > 0 {
+					runId, err := newJudgeRunId()
+					if err != nil {
+						return err
+					}
+					submission.RunId = runId
+				}
+				if err := tx.Create(&submission).Error; err != nil {
+					return err
+				}
+				if err := tx.Model(&solution).Update("last_submission_id", submission.Id).Error; err != nil {
+					return err
+				}
+				if testCaseCount == 0 {
+					continue
+				}
+
+				judgerSubmissionData, err := loadJudgerSubmissionData(tx, submission, problem)
+				if err != nil {
+					return err
+				}
+				judgerSubmissionDataList = append(judgerSubmissionDataList, judgerSubmissionData)
+			}
+
+			return nil
+		})
+		if matchError {
+			return
+		}
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create validation run"})
+			return
+		}
+
+		if judgerSubmissionDataList != nil {
+			if err = getConnection(rdb); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"redis": "disconnection",
+				})
+				return
+			}
+			for _, judgerSubmissionData := range judgerSubmissionDataList {
+				if err := pushJudgerSubmissionData(rdb, judgerSubmissionData); err != nil {
+					fmt.Println(err)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue validation run"})
+					return
+				}
+			}
+		}
+
+		report, status := getProblemValidationReport(db, problemId)
+		c.JSON(http.StatusOK, gin.H{
+			"status": status,
+			"data":   report,
+		})
+	}
+
+	getProblemValidationHandler := func(c *gin.Context) {
+		problemId, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get problem Id err: %s", err.Error()))
+			return
+		}
+
+		report, status := getProblemValidationReport(db, problemId)
+		c.JSON(http.StatusOK, gin.H{
+			"status": status,
+			"data":   report,
+		})
+	}
+
+	getProblemToolsHandler := func(c *gin.Context) {
+		problemId, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get problem Id err: %s", err.Error()))
+			return
+		}
+
+		var tools []ProblemTool
+		db.Transaction(func(tx *gorm.DB) error {
+			var problemTools []ProblemToolTable
+			tx.Where("problem_id = ?", problemId).Order("kind").Find(&problemTools)
+
+			for _, tool := range problemTools {
+				tools = append(tools, ProblemTool{Kind: tool.Kind, Language: tool.Language, Code: tool.Code})
+			}
+
+			return nil
+		})
+
+		c.JSON(http.StatusOK, gin.H{
+			"data": tools,
+		})
+	}
+
+	putProblemToolHandler := func(c *gin.Context) {
+		problemId, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get problem Id err: %s", err.Error()))
+			return
+		}
+		kind := c.Param("kind")
+		if !isValidProblemToolKind(kind) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tool kind"})
+			return
+		}
+
+		var toolDTO ProblemToolPutDTO
+		err = c.Bind(&toolDTO)
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("update tool err: %s", err.Error()))
+			return
+		}
+		if toolDTO.Language == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "language is required"})
+			return
+		}
+
+		var problem ProblemTable
+		db.First(&problem, problemId)
+		if problem.Id == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "problem not found"})
+			return
+		}
+
+		tool := ProblemToolTable{
+			Kind:      kind,
+			Language:  toolDTO.Language,
+			Code:      toolDTO.Code,
+			ProblemId: problemId,
+		}
+
+		// a new validator must accept the inputs the problem already has
+		if kind == PROBLEM_TOOL_VALIDATOR {
+			var inputs []string
+			db.Model(&TestCaseTable{}).Where("problem_id = ?", problemId).Order("id").Pluck("input", &inputs)
+
+			validationErrors, err := runValidator(rdb, tool, inputs, config.ToolRunTimeout)
+			if err != nil {
+				fmt.Println(err)
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": "validator is unavailable"})
+				return
+			}
+			if validationErrors != nil {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{
+					"error":   "validator rejected existing testcase inputs",
+					"details": validationErrors,
+				})
+				return
+			}
+		}
+
+		db.Transaction(func(tx *gorm.DB) error {
+			var oldTool ProblemToolTable
+			tx.Where("problem_id = ? AND kind = ?", problemId, kind).Find(&oldTool)
+			tool.Id = oldTool.Id
+
+			return tx.Save(&tool).Error
+		})
+
+		c.JSON(http.StatusOK, gin.H{
+			"Ok": true,
+		})
+	}
+
+	deleteProblemToolHandler := func(c *gin.Context) {
+		problemId, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get problem Id err: %s", err.Error()))
+			return
+		}
+
+		db.Transaction(func(tx *gorm.DB) error {
+			tx.Where("problem_id = ? AND kind = ?", problemId, c.Param("kind")).Delete(&ProblemToolTable{})
+
+			return nil
+		})
+
+		c.JSON(http.StatusOK, gin.H{
+			"Ok": true,
+		})
+	}
+
+	/* regenerate testcases on the judge
+	1. run the generator for every testcase with generatorArgs to get its input
+	2. run the validator on every input
+	3. run the model solution on every input to get the expected outputs
+	4. save inputs and outputs in one transaction
+	*/
+	regenerateTestCasesHandler := func(c *gin.Context) {
+		problemId, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get problem Id err: %s", err.Error()))
+			return
+		}
+
+		var testCases []TestCaseTable
+		db.Where("problem_id = ?", problemId).Order("id").Find(&testCases)
+		if len(testCases) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "problem has no testcases"})
+			return
+		}
+
+		toolsMap := make(map[string]ProblemToolTable)
+		var tools []ProblemToolTable
+		db.Where("problem_id = ?", problemId).Find(&tools)
+		for _, tool := range tools {
+			toolsMap[tool.Kind] = tool
+		}
+
+		modelSolution, ok := toolsMap[PROBLEM_TOOL_MODEL_SOLUTION]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "problem has no model solution"})
+			return
+		}
+
+		// 1. generate inputs
+		var generatorRuns []JudgerToolRun
+		var generatedIndexes []int
+		for i, testCase := range testCases {
+			if testCase.GeneratorArgs != "" {
+				generatorRuns = append(generatorRuns, JudgerToolRun{Args: testCase.GeneratorArgs})
+				generatedIndexes = append(generatedIndexes, i)
+			}
+		}
+		if generatorRuns != nil {
+			generator, ok := toolsMap[PROBLEM_TOOL_GENERATOR]
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "problem has no generator"})
+				return
+			}
+
+			outputs, err := runProblemTool(rdb, generator, generatorRuns, config.ToolRunTimeout)
+			if err != nil {
+				fmt.Println(err)
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": "generator is unavailable"})
+				return
+			}
+			for i, output := range outputs {
+				if output.ExitCode != 0 {
+					c.JSON(http.StatusUnprocessableEntity, gin.H{
+						"error":   "generator failed",
+						"details": TestCaseValidationError{Index: generatedIndexes[i], Error: output.Error},
+					})
+					return
+				}
+				testCases[generatedIndexes[i]].Input = output.Output
+			}
+		}
+
+		var inputs []string
+		for _, testCase := range testCases {
+			inputs = append(inputs, testCase.Input)
+		}
+
+		// 2. validate inputs
+		if validator, ok := toolsMap[PROBLEM_TOOL_VALIDATOR]; ok {
+			validationErrors, err := runValidator(rdb, validator, inputs, config.ToolRunTimeout)
+			if err != nil {
+				fmt.Println(err)
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": "validator is unavailable"})
+				return
+			}
+			if validationErrors != nil {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{
+					"error":   "validator rejected testcase inputs",
+					"details": validationErrors,
+				})
+				return
+			}
+		}
+
+		// 3. expected outputs
+		var modelRuns []JudgerToolRun
+		for _, input := range inputs {
+			modelRuns = append(modelRuns, JudgerToolRun{Input: input})
+		}
+		outputs, err := runProblemTool(rdb, modelSolution, modelRuns, config.ToolRunTimeout)
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "model solution is unavailable"})
+			return
+		}
+		for i, output := range outputs {
+			if output.ExitCode != 0 {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{
+					"error":   "model solution failed",
+					"details": TestCaseValidationError{Index: i, Error: output.Error},
+				})
+				return
+			}
+			testCases[i].ExpectedOutput = output.Output
+		}
+
+		// 4. save
+		err = db.Transaction(func(tx *gorm.DB) error {
+			for _, testCase := range testCases {
+				err := tx.Model(&TestCaseTable{Id: testCase.Id}).Updates(map[string]interface{}{
+					"input":           testCase.Input,
+					"expected_output": testCase.ExpectedOutput,
+				}).Error
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save testcases"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"Ok": true,
+		})
+	}
+
+	authorizeProblemOwner := authorizeProblemRole(db, PROBLEM_ROLE_OWNER)
+	authorizeProblemEditor := authorizeProblemRole(db, PROBLEM_ROLE_EDITOR)
+	authorizeProblemManager := authorizePermission(PERMISSION_MANAGE_PROBLEMS)
+
+	problems := r.Group("/problems")
+	{
+		problems.GET("/", getProblemsHandler)
+		problems.GET("/:id", getProblemByIDHandler)
+		problems.GET("/:id/stats", getProblemStatsHandler)
+		problems.POST("/", authorizeProblemManager, createProblemHandler)
+		problems.PUT("/:id", authorizeProblemEditor, updateProblemByIDHandler)
+		problems.DELETE("/:id", authorizeProblemOwner, deleteProblemByIDHandler)
+		problems.GET("/trash", authorizeProblemManager, getDeletedProblemsHandler)
+		problems.POST("/trash/purge", authorizeProblemManager, purgeDeletedProblemsHandler)
+		problems.POST("/:id/restore", authorizeProblemManager, restoreProblemByIDHandler)
+		problems.DELETE("/:id/purge", authorizeProblemManager, purgeProblemByIDHandler)
+		problems.PUT("/:id/statements/:lang", authorizeProblemEditor, putProblemStatementHandler)
+		problems.DELETE("/:id/statements/:lang", authorizeProblemEditor, deleteProblemStatementHandler)
+		problems.POST("/:id/attachments", authorizeProblemEditor, createProblemAttachmentHandler)
+		problems.DELETE("/:id/attachments/:attachmentId", authorizeProblemEditor, deleteProblemAttachmentHandler)
+		problems.GET("/:id/collaborators", authorizeProblemOwner, getProblemCollaboratorsHandler)
+		problems.PUT("/:id/collaborators/:userId", authorizeProblemOwner, putProblemCollaboratorHandler)
+		problems.DELETE("/:id/collaborators/:userId", authorizeProblemOwner, deleteProblemCollaboratorHandler)
+		problems.GET("/:id/editorial", getProblemEditorialHandler)
+		problems.PUT("/:id/editorial", authorizeProblemEditor, putProblemEditorialHandler)
+		problems.PUT("/:id/editorial/unlock", authorizeProblemManager, unlockProblemEditorialHandler)
+		problems.POST("/:id/reference-solutions", authorizeProblemEditor, createReferenceSolutionHandler)
+		problems.DELETE("/:id/reference-solutions/:solutionId", authorizeProblemEditor, deleteReferenceSolutionHandler)
+		problems.POST("/:id/validate", authorizeProblemEditor, validateProblemHandler)
+		problems.GET("/:id/validation", authorizeProblemEditor, getProblemValidationHandler)
+		problems.GET("/:id/tools", authorizeProblemEditor, getProblemToolsHandler)
+		problems.PUT("/:id/tools/:kind", authorizeProblemEditor, putProblemToolHandler)
+		problems.DELETE("/:id/tools/:kind", authorizeProblemEditor, deleteProblemToolHandler)
+		problems.POST("/:id/testcases/regenerate", authorizeProblemEditor, regenerateTestCasesHandler)
+	}
+
+	// group: tags
+	getTagsHandler := func(c *gin.Context) {
+		var tags []Tag
+
+		db.Transaction(func(tx *gorm.DB) error {
+			// only count problems the requester is allowed to see
+			problemsJoin := "LEFT JOIN problem_tables ON problem_tables.id = problem_tag_tables.problem_id" +
+				" AND problem_tables.deleted_at IS NULL"
+			var problemsJoinArgs []interface{}
+			if !canManageProblems(c) {
+				problemsJoin += " AND problem_tables.visibility IN ? AND (problem_tables.publish_at IS NULL OR problem_tables.publish_at <= ?)"
+				problemsJoinArgs = append(problemsJoinArgs, []string{PROBLEM_PUBLISHED, PROBLEM_ARCHIVED}, time.Now())
+			}
+
+			rows, err := tx.Model(&TagTable{}).
+				Select("tag_tables.id, tag_tables.name, COUNT(problem_tables.id) AS problem_count").
+				Joins("LEFT JOIN problem_tag_tables ON problem_tag_tables.tag_id = tag_tables.id").
+				Joins(problemsJoin, problemsJoinArgs...).
+				Group("tag_tables.id, tag_tables.name").
+				Order("tag_tables.name").Rows()
+			if err != nil {
+				fmt.Println(err)
+				return err
+			}
+			defer rows.Close()
+
+			for rows.Next() {
+				var tagId, problemCount int
+				var name string
+				rows.Scan(&tagId, &name, &problemCount)
+
+				tags = append(tags, Tag{
+					Id:           strconv.Itoa(tagId),
+					Name:         name,
+					ProblemCount: problemCount,
+				})
+			}
+
+			return nil
+		})
+
+		c.JSON(http.StatusOK, gin.H{
+			"data": tags,
+		})
+	}
+
+	createTagHandler := func(c *gin.Context) {
+		var newTagDTO TagPostDTO
+
+		err := c.Bind(&newTagDTO)
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("create tag err: %s", err.Error()))
+			return
+		}
+		newTag := TagTable{Name: strings.TrimSpace(newTagDTO.Name)}
+		if newTag.Name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "tag name is empty"})
+			return
+		}
+
+		duplicateError := false
+		db.Transaction(func(tx *gorm.DB) error {
+			var count int64
+			tx.Model(&TagTable{}).Where("name = ?", newTag.Name).Count(&count)
+			if count > 0 {
+				c.JSON(http.StatusConflict, gin.H{"error": "tag already exists"})
+				duplicateError = true
+				return nil
+			}
+
+			return tx.Create(&newTag).Error
+		})
+		if duplicateError {
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"tag_id": newTag.Id,
+		})
+	}
+
+	updateTagByIDHandler := func(c *gin.Context) {
+		tagId, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get tag Id err: %s", err.Error()))
+			return
+		}
+
+		var updatedTag TagPutDTO
+		err = c.Bind(&updatedTag)
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("update tag err: %s", err.Error()))
+			return
+		}
+		name := strings.TrimSpace(updatedTag.Name)
+		if name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "tag name is empty"})
+			return
+		}
+
+		matchError := false
+		db.Transaction(func(tx *gorm.DB) error {
+			var count int64
+			tx.Model(&TagTable{}).Where("name = ? AND id <> ?", name, tagId).Count(&count)
+			if count > 0 {
+				c.JSON(http.StatusConflict, gin.H{"error": "tag already exists"})
+				matchError = true
+				return nil
+			}
+
+			result := tx.Model(&TagTable{Id: tagId}).Updates(TagTable{Name: name})
+			if result.RowsAffected == 0 {
+				c.JSON(http.StatusNotFound, gin.H{"error": "tag not found"})
+				matchError = true
+				return nil
+			}
+
+			return nil
+		})
+		if matchError {
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"Ok": true,
+		})
+	}
+
+	deleteTagByIDHandler := func(c *gin.Context) {
+		tagId, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get tag Id err: %s", err.Error()))
+			return
+		}
+
+		db.Transaction(func(tx *gorm.DB) error {
+			tx.Where("tag_id = ?", tagId).Delete(&ProblemTagTable{})
+			tx.Delete(&TagTable{}, tagId)
+
+			return nil
+		})
+
+		c.JSON(http.StatusOK, gin.H{
+			"Ok": true,
+		})
+	}
+
+	tags := r.Group("/tags")
+	{
+		tags.GET("/", getTagsHandler)
+	}
+	tags.Use(authorizePermission(PERMISSION_MANAGE_PROBLEMS))
+	{
+		tags.POST("/", createTagHandler)
+		tags.PUT("/:id", updateTagByIDHandler)
+		tags.DELETE("/:id", deleteTagByIDHandler)
+	}
+
+	createUserHandler := func(c *gin.Context) {
+		var newUserDTO UserPostDTO
+		var newUser UserTable
+		var newUserId int
+
+		err := c.Bind(&newUserDTO)
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("create user err: %s", err.Error()))
+			return
+		}
+		if fieldErrors := validateUserPostDTO(&newUserDTO); fieldErrors != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid user", "fields": fieldErrors})
+			return
+		}
+
+		hashedPassword, err := hashPassword(newUserDTO.Password)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+			return
+		}
+		newUser = UserTable{
+			Username: newUserDTO.Username,
+			Password: hashedPassword,
+			Name:     newUserDTO.Name,
+			Email:    newUserDTO.Email,
+		}
+
+		var conflicts []FieldError
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var count int64
+			tx.Model(&UserTable{}).Where("LOWER(username) = LOWER(?)", newUser.Username).Count(&count)
+			if count > 0 {
+				conflicts = append(conflicts, FieldError{Field: "username", Error: "is already taken"})
+			}
+			tx.Model(&UserTable{}).Where("LOWER(email) = LOWER(?)", newUser.Email).Count(&count)
+			if count > 0 {
+				conflicts = append(conflicts, FieldError{Field: "email", Error: "is already registered"})
+			}
+			if conflicts != nil {
+				return nil
+			}
+
+			if err := tx.Create(&newUser).Error; err != nil {
+				return err
+			}
+			newUserId = newUser.Id
+
+			return nil
+		})
+		// lost a race against a concurrent registration
+		if constraint, ok := uniqueViolationConstraint(err); ok && constraint == EMAIL_INDEX {
+			conflicts = append(conflicts, FieldError{Field: "email", Error: "is already registered"})
+		} else if ok {
+			conflicts = append(conflicts, FieldError{Field: "username", Error: "is already taken"})
+		} else if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+			return
+		}
+		if conflicts != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "user already exists", "fields": conflicts})
+			return
+		}
+
+		// registration doesn't fail on a mail problem, the user can ask again
+		if newUser.Email != "" {
+			if err := sendEmailVerification(db, mailer, config.BaseURL, newUser); err != nil {
+				fmt.Println(err)
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"user_id": newUserId,
+		})
+	}
+
+	resendEmailVerificationHandler := func(c *gin.Context) {
+		var user UserTable
+		userId, _ := getCurrentUserId(c)
+
+		db.Find(&user, userId)
+		if user.Email == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "user has no email"})
+			return
+		}
+		if user.EmailVerified {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "email is already verified"})
+			return
+		}
+
+		if err := sendEmailVerification(db, mailer, config.BaseURL, user); err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification mail"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"Ok": true,
+		})
+	}
+
+	verifyEmailHandler := func(c *gin.Context) {
+		var emailVerifyDTO EmailVerifyDTO
+
+		err := c.Bind(&emailVerifyDTO)
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("verify email err: %s", err.Error()))
+			return
+		}
+
+		matchError := false
+		err = db.Transaction(func(tx *gorm.DB) error {
+			userToken, ok, err := consumeUserToken(tx, emailVerifyDTO.Token, USER_TOKEN_EMAIL_VERIFICATION)
+			if err != nil {
+				return err
+			}
+
+			// the address must not have changed since the mail was sent
+			var user UserTable
+			tx.Find(&user, userToken.UserId)
+			if !ok || user.Id == 0 || user.Email != userToken.Email {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired token"})
+				matchError = true
+				return nil
+			}
+
+			return tx.Model(&user).Update("email_verified", true).Error
+		})
+		if matchError == true {
+			return
+		}
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"Ok": true,
+		})
+	}
+
+	// always answers the same so it can't be used to probe for addresses
+	forgotPasswordHandler := func(c *gin.Context) {
+		var passwordForgotDTO PasswordForgotDTO
+
+		err := c.Bind(&passwordForgotDTO)
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("forgot password err: %s", err.Error()))
+			return
+		}
+
+		email := strings.TrimSpace(passwordForgotDTO.Email)
+		if email != "" {
+			var user UserTable
+			db.Where("LOWER(email) = LOWER(?) AND disabled = ?", email, false).Find(&user)
+			if user.Id != 0 {
+				if err := sendPasswordReset(db, mailer, config.BaseURL, user); err != nil {
+					fmt.Println(err)
+				}
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "if the address belongs to an account, a reset link has been sent",
+		})
+	}
+
+	resetPasswordHandler := func(c *gin.Context) {
+		var passwordResetDTO PasswordResetDTO
+
+		err := c.Bind(&passwordResetDTO)
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("reset password err: %s", err.Error()))
+			return
+		}
+		if message := validatePassword(passwordResetDTO.Password, ""); message != "" {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error":  "invalid password",
+				"fields": []FieldError{{Field: "password", Error: message}},
+			})
+			return
+		}
+
+		hashedPassword, err := hashPassword(passwordResetDTO.Password)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+			return
+		}
+
+		var userId int
+		matchError := false
+		err = db.Transaction(func(tx *gorm.DB) error {
+			userToken, ok, err := consumeUserToken(tx, passwordResetDTO.Token, USER_TOKEN_PASSWORD_RESET)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired token"})
+				matchError = true
+				return nil
+			}
+			var user UserTable
+			tx.Find(&user, userToken.UserId)
+			if user.Id == 0 || user.Disabled {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired token"})
+				matchError = true
+				return nil
+			}
+			userId = user.Id
+
+			updates := map[string]interface{}{"password": hashedPassword}
+			// the mail reached the address, so it counts as verified too
+			if user.Email == userToken.Email {
+				updates["email_verified"] = true
+			}
+			return tx.Model(&user).Updates(updates).Error
+		})
+		if matchError == true {
+			return
+		}
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+			return
+		}
+
+		// whoever knew the old password is logged out
+		if err := sessionStore.DeleteAll(c.Request.Context(), userId, ""); err != nil {
+			fmt.Println(err)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"Ok": true,
+		})
+	}
+
+	loginHandler := func(c *gin.Context) {
+		var userLoginDTO UserLoginDTO
+		var userId int
+		var roles []string
+		var twoFactorSetupRequired bool
+
+		err := c.Bind(&userLoginDTO)
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("login err: %s", err.Error()))
+			return
+		}
+		if userLoginDTO.Username == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "username is required"})
+			return
+		}
+
+		ctx := c.Request.Context()
+		retryAfter, err := loginThrottle.RetryAfter(ctx, c.ClientIP(), userLoginDTO.Username)
+		if err != nil {
+			fmt.Println(err)
+		}
+		if retryAfter > 0 {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(seconds))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many login attempts", "retryAfter": seconds})
+			return
+		}
+
+		var requesetUser UserTable
+		dbError := false
+		db.Transaction(func(tx *gorm.DB) error {
+			// the same answer whether the username or the password is wrong
+			tx.Where("username = ?", userLoginDTO.Username).Find(&requesetUser)
+
+			// answered before the password is checked, so it tells nothing about it
+			if requesetUser.Id != 0 && requesetUser.Disabled {
+				c.JSON(http.StatusForbidden, gin.H{"error": "user is disabled"})
+				dbError = true
+				return nil
+			}
+
+			ok, needsRehash := false, false
+			if requesetUser.Id == 0 {
+				verifyDummyPassword(userLoginDTO.Password)
+			} else {
+				ok, needsRehash = verifyPassword(userLoginDTO.Password, requesetUser.Password)
+			}
+			if !ok {
+				if err := loginThrottle.RecordFailure(ctx, c.ClientIP(), userLoginDTO.Username); err != nil {
+					fmt.Println(err)
+				}
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid username or password"})
+				dbError = true
+				return nil
+			}
+
+			if totp, ok := getEnabledTotp(tx, requesetUser.Id); ok {
+				if userLoginDTO.Code == "" {
+					c.JSON(http.StatusUnauthorized, gin.H{"error": "two-factor code required", "twoFactorRequired": true})
+					dbError = true
+					return nil
+				}
+				if !verifySecondFactor(tx, totp, userLoginDTO.Code) {
+					if err := loginThrottle.RecordFailure(ctx, c.ClientIP(), userLoginDTO.Username); err != nil {
+						fmt.Println(err)
+					}
+					c.JSON(http.StatusBadRequest, gin.H{"error": "invalid two-factor code"})
+					dbError = true
+					return nil
+				}
+			}
+
+			// migrate legacy or outdated hashes while the plain password is at hand
+			if needsRehash {
+				hashedPassword, err := hashPassword(userLoginDTO.Password)
+				if err == nil {
+					err = tx.Model(&requesetUser).Update("password", hashedPassword).Error
+				}
+				if err != nil {
+					fmt.Println("rehash password error", err)
+				}
+			}
+
+			userId = requesetUser.Id
+			roles = getUserRoleNames(tx, userId)
+			twoFactorSetupRequired = needsTwoFactorSetup(tx, userId)
+			return nil
+		})
+		if dbError == true {
+			return
+		}
+
+		if err := loginThrottle.RecordSuccess(ctx, userLoginDTO.Username); err != nil {
+			fmt.Println(err)
+		}
+
+		// a fresh session on every login, the old one (if any) is left to be revoked
+		if _, err := sessionStore.Create(c, userId); err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save session"})
+			return
+		}
+
+		// roles requiring 2FA grant nothing until it's set up
+		c.JSON(http.StatusOK, gin.H{
+			"user_id":                userId,
+			"user_roles":             roles,
+			"twoFactorSetupRequired": twoFactorSetupRequired,
+		})
+	}
+
+	logoutHandler := func(c *gin.Context) {
+		if _, ok := getCurrentUser(c); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session token"})
+			return
+		}
+
+		if err := sessionStore.Destroy(c); err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save session"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Successfully logged out"})
+	}
+
+	getSessionsHandler := func(c *gin.Context) {
+		userId, _ := getCurrentUserId(c)
+		currentSessionId := c.GetString(sessionIdKey)
+
+		sessions, err := sessionStore.List(c.Request.Context(), userId)
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load sessions"})
+			return
+		}
+
+		sort.Slice(sessions, func(i, j int) bool {
+			return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+		})
+
+		sessionInfos := []SessionInfo{}
+		for _, session := range sessions {
+			sessionInfos = append(sessionInfos, SessionInfo{
+				Id:         session.Id,
+				CreatedAt:  session.CreatedAt,
+				LastSeenAt: session.LastSeenAt,
+				IP:         session.IP,
+				UserAgent:  session.UserAgent,
+				Current:    session.Id == currentSessionId,
+			})
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"sessions": sessionInfos,
+		})
+	}
+
+	deleteSessionHandler := func(c *gin.Context) {
+		userId, _ := getCurrentUserId(c)
+		sessionId := c.Param("sessionId")
+		ctx := c.Request.Context()
+
+		// only sessions of the current user can be revoked here
+		session, ok, err := sessionStore.Get(ctx, sessionId)
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load session"})
+			return
+		}
+		if !ok || session.UserId != userId {
+			c.JSON(http.StatusNotFound, gin.H{"error": "session not exist"})
+			return
+		}
+
+		if sessionId == c.GetString(sessionIdKey) {
+			err = sessionStore.Destroy(c)
+		} else {
+			err = sessionStore.Delete(ctx, userId, sessionId)
+		}
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "session revoked"})
+	}
+
+	// log out everywhere else, the current session stays
+	deleteOtherSessionsHandler := func(c *gin.Context) {
+		userId, _ := getCurrentUserId(c)
+
+		if err := sessionStore.DeleteAll(c.Request.Context(), userId, c.GetString(sessionIdKey)); err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "other sessions revoked"})
+	}
+
+	forceLogoutUserHandler := func(c *gin.Context) {
+		var user UserTable
+		db.Where(&UserTable{Username: c.Param("username")}).Find(&user)
+		if user.Id == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not exist"})
+			return
+		}
+
+		if err := sessionStore.DeleteAll(c.Request.Context(), user.Id, ""); err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "user logged out"})
+	}
+
+	createApiTokenHandler := func(c *gin.Context) {
+		var apiTokenDTO ApiTokenPostDTO
+		userId, _ := getCurrentUserId(c)
+
+		err := c.Bind(&apiTokenDTO)
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("create api token err: %s", err.Error()))
+			return
+		}
+
+		apiTokenDTO.Name = strings.TrimSpace(apiTokenDTO.Name)
+		if apiTokenDTO.Name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "api token name is empty"})
+			return
+		}
+		if len(apiTokenDTO.Scopes) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "api token needs at least one scope"})
+			return
+		}
+		for _, scope := range apiTokenDTO.Scopes {
+			if !isValidApiTokenScope(scope) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid scope: %s", scope)})
+				return
+			}
+		}
+		if apiTokenDTO.ExpiresAt != nil && apiTokenDTO.ExpiresAt.Before(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expiresAt is in the past"})
+			return
+		}
+
+		secret, err := randomHex(32)
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create api token"})
+			return
+		}
+		token := API_TOKEN_PREFIX + secret
+
+		newToken := ApiTokenTable{
+			Name:      apiTokenDTO.Name,
+			TokenHash: hashToken(token),
+			Scopes:    strings.Join(apiTokenDTO.Scopes, ","),
+			ExpiresAt: apiTokenDTO.ExpiresAt,
+			UserId:    userId,
+		}
+		if err := db.Create(&newToken).Error; err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create api token"})
+			return
+		}
+
+		// the plain token is only ever returned here
+		c.JSON(http.StatusOK, gin.H{
+			"token":    token,
+			"apiToken": newApiToken(newToken),
+		})
+	}
+
+	getApiTokensHandler := func(c *gin.Context) {
+		var apiTokenTables []ApiTokenTable
+		userId, _ := getCurrentUserId(c)
+
+		db.Where(&ApiTokenTable{UserId: userId}).Order("id").Find(&apiTokenTables)
+
+		apiTokens := []ApiToken{}
+		for _, apiToken := range apiTokenTables {
+			apiTokens = append(apiTokens, newApiToken(apiToken))
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"apiTokens": apiTokens,
+		})
+	}
+
+	deleteApiTokenHandler := func(c *gin.Context) {
+		userId, _ := getCurrentUserId(c)
+		tokenId, err := strconv.Atoi(c.Param("tokenId"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get api token Id err: %s", err.Error()))
+			return
+		}
+
+		result := db.Where("id = ? AND user_id = ?", tokenId, userId).Delete(&ApiTokenTable{})
+		if result.Error != nil {
+			fmt.Println(result.Error)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke api token"})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "api token not exist"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "api token revoked"})
+	}
+
+	// group: roles
+	getRolesHandler := func(c *gin.Context) {
+		var roleTables []RoleTable
+		var roles []Role
+
+		db.Transaction(func(tx *gorm.DB) error {
+			tx.Order("name").Find(&roleTables)
+			roles = newRoles(tx, roleTables)
+
+			return nil
+		})
+
+		c.JSON(http.StatusOK, gin.H{
+			"roles":       roles,
+			"permissions": allPermissions,
+		})
+	}
+
+	// create a role or replace its description and permissions
+	putRoleHandler := func(c *gin.Context) {
+		var rolePutDTO RolePutDTO
+		name := strings.TrimSpace(c.Param("name"))
+
+		err := c.Bind(&rolePutDTO)
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("put role err: %s", err.Error()))
+			return
+		}
+
+		if name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "role name is empty"})
+			return
+		}
+		if name == ROLE_ADMIN {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "admin role can't be changed"})
+			return
+		}
+		for _, permission := range rolePutDTO.Permissions {
+			if !isValidPermission(permission) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid permission: %s", permission)})
+				return
+			}
+		}
+
+		var role RoleTable
+		err = db.Transaction(func(tx *gorm.DB) error {
+			tx.Where(&RoleTable{Name: name}).Find(&role)
+			role.Name = name
+			role.Description = rolePutDTO.Description
+			if err := tx.Save(&role).Error; err != nil {
+				return err
+			}
+
+			if err := tx.Where("role_id = ?", role.Id).Delete(&RolePermissionTable{}).Error; err != nil {
+				return err
+			}
+			for _, permission := range rolePutDTO.Permissions {
+				rolePermission := RolePermissionTable{RoleId: role.Id, Permission: permission}
+				if err := tx.FirstOrCreate(&rolePermission, rolePermission).Error; err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save role"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"role": newRoles(db, []RoleTable{role})[0],
+		})
+	}
+
+	deleteRoleHandler := func(c *gin.Context) {
+		name := c.Param("name")
+		if isBuiltinRole(name) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "built-in roles can't be deleted"})
+			return
+		}
+
+		matchError := false
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var role RoleTable
+			tx.Where(&RoleTable{Name: name}).Find(&role)
+			if role.Id == 0 {
+				c.JSON(http.StatusNotFound, gin.H{"error": "role not exist"})
+				matchError = true
+				return nil
+			}
+
+			if err := tx.Where("role_id = ?", role.Id).Delete(&UserRoleTable{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("role_id = ?", role.Id).Delete(&RolePermissionTable{}).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&role).Error
+		})
+		if matchError == true {
+			return
+		}
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete role"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"Ok": true,
+		})
+	}
 
-func verifyPassword(password string, dbPassword string) bool {
-	return encryptBySha256(password) == dbPassword
-}
+	putRoleTwoFactorHandler := func(c *gin.Context) {
+		var roleTwoFactorDTO RoleTwoFactorPutDTO
 
-func authorizeNormalUser(c *gin.Context) {
-	session := sessions.Default(c)
-	user := session.Get(userKey)
-	if user == nil {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
-		return
-	}
+		err := c.Bind(&roleTwoFactorDTO)
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("put role two-factor err: %s", err.Error()))
+			return
+		}
 
-	c.Next()
-}
+		var role RoleTable
+		db.Where(&RoleTable{Name: c.Param("name")}).Find(&role)
+		if role.Id == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "role not exist"})
+			return
+		}
 
-func authorizeSuperUser(c *gin.Context) {
-	session := sessions.Default(c)
-	user := session.Get(userKey)
+		if err := db.Model(&role).Update("require_two_factor", roleTwoFactorDTO.Required).Error; err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save role"})
+			return
+		}
 
-	if user == nil {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
-		return
+		c.JSON(http.StatusOK, gin.H{
+			"role": newRoles(db, []RoleTable{role})[0],
+		})
 	}
 
-	authority, err := strconv.Atoi(user.(UserIdAuthorityPrincipal).Authority)
-	if err != nil {
-		c.String(http.StatusUnauthorized, fmt.Sprintf("get authority err: %s", err.Error()))
-		return
-	}
-	if authority < 2 {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
-		return
+	roles := r.Group("/roles")
+	roles.Use(authorizePermission(PERMISSION_MANAGE_USERS))
+	{
+		roles.GET("/", getRolesHandler)
+		roles.PUT("/:name", putRoleHandler)
+		roles.DELETE("/:name", deleteRoleHandler)
+		roles.PUT("/:name/two-factor", putRoleTwoFactorHandler)
 	}
 
-	c.Next()
-}
-
-func getConnection(rdb *redis.Client) error {
-	ctx := context.Background()
-	pong, err := rdb.Ping(ctx).Result()
+	getUserRolesHandler := func(c *gin.Context) {
+		var user UserTable
+		db.Where(&UserTable{Username: c.Param("username")}).Find(&user)
+		if user.Id == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not exist"})
+			return
+		}
 
-	if err != nil {
-		fmt.Println("ping error, try reconnect", err.Error())
-		rdb = redis.NewClient(&redis.Options{})
-		pong, err = rdb.Ping(ctx).Result()
-		return err
+		c.JSON(http.StatusOK, gin.H{
+			"roles":       getUserRoleNames(db, user.Id),
+			"permissions": getUserPermissions(db, user.Id),
+		})
 	}
 
-	fmt.Println("ping result:", pong)
-	return nil
-}
+	assignUserRoleHandler := func(c *gin.Context) {
+		var user UserTable
+		var role RoleTable
+		db.Where(&UserTable{Username: c.Param("username")}).Find(&user)
+		if user.Id == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not exist"})
+			return
+		}
+		db.Where(&RoleTable{Name: c.Param("role")}).Find(&role)
+		if role.Id == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "role not exist"})
+			return
+		}
 
-func main() {
-	// init for session encode
-	gob.Register(UserIdAuthorityPrincipal{})
+		userRole := UserRoleTable{UserId: user.Id, RoleId: role.Id}
+		if err := db.FirstOrCreate(&userRole, userRole).Error; err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign role"})
+			return
+		}
 
-	db, err := initDatabase()
-	if err != nil {
-		fmt.Println(err)
-		return
+		c.JSON(http.StatusOK, gin.H{
+			"roles": getUserRoleNames(db, user.Id),
+		})
 	}
 
-	rdb := redis.NewClient(&redis.Options{})
-	defer rdb.Close()
-
-	// create tables
-	db.Transaction(func(tx *gorm.DB) error {
-		tx.AutoMigrate(&ProblemTable{}, &TestCaseTable{}, &UserTable{}, &SubmissionTable{})
-
-		return nil
-	})
-
-	r := gin.Default()
-	store := cookie.NewStore([]byte("secret"))
-	r.Use(sessions.Sessions("mysession", store))
-
-	r.GET("/", func(c *gin.Context) {
-		c.String(200, "Hello, Jimmy_kiet.")
-	})
-
-	// group: problems
-	getProblemsHandler := func(c *gin.Context) {
-		var problems []problemsMap
-
-		db.Transaction(func(tx *gorm.DB) error {
-			// do some database operations in the transaction (use 'tx' from this point, not 'db')
-			rows, err := tx.Model(&ProblemTable{}).Rows()
-			defer rows.Close()
-			if err != nil {
-				fmt.Println(err)
-				return err
-			}
-
-			for rows.Next() {
-				var problem ProblemTable
-				// ScanRows is a method of `gorm.DB`, it can be used to scan a row into a struct
-				tx.ScanRows(rows, &problem)
+	removeUserRoleHandler := func(c *gin.Context) {
+		var user UserTable
+		var role RoleTable
+		db.Where(&UserTable{Username: c.Param("username")}).Find(&user)
+		if user.Id == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not exist"})
+			return
+		}
+		db.Where(&RoleTable{Name: c.Param("role")}).Find(&role)
+		if role.Id == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "role not exist"})
+			return
+		}
 
-				// do something
-				temp := problemsMap{
-					"id":    strconv.Itoa(problem.Id),
-					"title": problem.Title,
-				}
-				problems = append(problems, temp)
-			}
+		// keep admins from locking themselves out
+		if currentUserId, _ := getCurrentUserId(c); currentUserId == user.Id && role.Name == ROLE_ADMIN {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "can't remove your own admin role"})
+			return
+		}
 
-			// return nil will commit the whole transaction
-			return nil
-		})
+		if err := db.Where(&UserRoleTable{UserId: user.Id, RoleId: role.Id}).Delete(&UserRoleTable{}).Error; err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove role"})
+			return
+		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"data": problems,
+			"roles": getUserRoleNames(db, user.Id),
 		})
 	}
 
-	createProblemHandler := func(c *gin.Context) {
-		var newProblemDTO ProblemPostDTO
-		var newProblem ProblemTable
-		var newProblemId int
+	// group: user management
+	getUsersHandler := func(c *gin.Context) {
+		var userTables []UserTable
+		var total int64
+		accounts := []UserAccount{}
 
-		err := c.Bind(&newProblemDTO)
+		page, pageSize, err := getPagination(c)
 		if err != nil {
-			c.String(http.StatusBadRequest, fmt.Sprintf("create problem err: %s", err.Error()))
+			c.String(http.StatusBadRequest, fmt.Sprintf("get pagination err: %s", err.Error()))
 			return
 		}
-		newProblem = ProblemTable{
-			Title:       newProblemDTO.Title,
-			Description: newProblemDTO.Description,
-		}
+		// ?q= searches username, name and email
+		q := strings.TrimSpace(c.Query("q"))
 
 		db.Transaction(func(tx *gorm.DB) error {
-			tx.Create(&newProblem)
-			newProblemId = newProblem.Id
+			query := tx.Model(&UserTable{})
+			if q != "" {
+				pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(q) + "%"
+				query = query.Where("username ILIKE ? OR name ILIKE ? OR email ILIKE ?", pattern, pattern, pattern)
+			}
+			query.Count(&total)
+			query.Order("id").Offset((page - 1) * pageSize).Limit(pageSize).Find(&userTables)
 
-			for _, TestCase := range newProblemDTO.TestCases {
-				tempTestCase := TestCaseTable{
-					Input:          TestCase.Input,
-					ExpectedOutput: TestCase.ExpectedOutput,
-					Comment:        TestCase.Comment,
-					Score:          TestCase.Score,
-					TimeOutSeconds: TestCase.TimeOutSeconds,
-					ProblemId:      newProblemId,
+			var userIds []int
+			for _, user := range userTables {
+				userIds = append(userIds, user.Id)
+			}
+			roleNamesMap := getUserRoleNamesMap(tx, userIds)
+
+			for _, user := range userTables {
+				roles := roleNamesMap[user.Id]
+				if roles == nil {
+					roles = []string{}
 				}
-				tx.Create(&tempTestCase)
+				accounts = append(accounts, newUserAccount(user, roles))
 			}
 
 			return nil
 		})
 
 		c.JSON(http.StatusOK, gin.H{
-			"problem_id": newProblemId,
+			"data":     accounts,
+			"total":    total,
+			"page":     page,
+			"pageSize": pageSize,
 		})
 	}
 
-	getProblemByIDHandler := func(c *gin.Context) {
-		problemId, err := strconv.Atoi(c.Param("id"))
-		if err != nil {
-			c.String(http.StatusBadRequest, fmt.Sprintf("get problem Id err: %s", err.Error()))
-			return
-		}
+	getUserAccountHandler := func(c *gin.Context) {
+		var account UserAccount
+		matchError := false
 
-		var responseData Problem
-		var requesetProblem ProblemTable
 		db.Transaction(func(tx *gorm.DB) error {
-			tx.First(&requesetProblem, problemId)
-			if requesetProblem.Id == 0 {
+			var user UserTable
+			tx.Where(&UserTable{Username: c.Param("username")}).Find(&user)
+			if user.Id == 0 {
+				c.JSON(http.StatusNotFound, gin.H{"error": "user not exist"})
+				matchError = true
 				return nil
 			}
+			account = newUserAccount(user, getUserRoleNames(tx, user.Id))
 
-			rows, err := tx.Model(&TestCaseTable{}).Where("problem_id = ?", problemId).Rows()
-			defer rows.Close()
-			if err != nil {
-				fmt.Println(err)
-				return err
-			}
-
-			var requestTestcases []TestCase
-			for rows.Next() {
-				var testcase TestCaseTable
-				tx.ScanRows(rows, &testcase)
-
-				temp := TestCase{
-					Id:             strconv.Itoa(testcase.Id),
-					Input:          testcase.Input,
-					ExpectedOutput: testcase.ExpectedOutput,
-					Comment:        testcase.Comment,
-					Score:          testcase.Score,
-					TimeOutSeconds: testcase.TimeOutSeconds,
-				}
-
-				requestTestcases = append(requestTestcases, temp)
-			}
-
-			responseData = Problem{
-				Id:          strconv.Itoa(requesetProblem.Id),
-				Title:       requesetProblem.Title,
-				Description: requesetProblem.Description,
-				TestCases:   requestTestcases,
+			// reference solution runs aren't the user's own submissions
+			submissions := func() *gorm.DB {
+				return tx.Model(&SubmissionTable{}).
+					Where("user_id = ? AND reference_solution_id = 0 AND result <> ?", user.Id, SUBMISSION_CANCELLED)
 			}
+			submissions().Count(&account.SubmissionCount)
+			submissions().Where("result = ?", SUBMISSION_ACCEPTED).Count(&account.AcceptedCount)
+			submissions().Where("result = ?", SUBMISSION_ACCEPTED).Distinct("problem_id").Count(&account.SolvedCount)
 
 			return nil
 		})
+		if matchError == true {
+			return
+		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"data": responseData,
+			"data": account,
 		})
 	}
 
-	/* three cases
-	1. use map to record new testcases
-	2. iterate on old testcases
-	2-1. if cur testcase not in new testcases set, <delete cur testcase>
-	3. iterate on new testcases
-	3-1. if cur testcase id is empty(string -> ""), <create cur testcase>
-	3-2. else, <update cur testcase>
-	*/
-	updateProblemByIDHandler := func(c *gin.Context) {
-		problemId, err := strconv.Atoi(c.Param("id"))
+	// disabling also logs the user out everywhere
+	disableUserHandler := func(c *gin.Context) {
+		var userDisableDTO UserDisablePutDTO
+		var user UserTable
+
+		err := c.Bind(&userDisableDTO)
 		if err != nil {
-			c.String(http.StatusBadRequest, fmt.Sprintf("get problem Id err: %s", err.Error()))
+			c.String(http.StatusBadRequest, fmt.Sprintf("disable user err: %s", err.Error()))
 			return
 		}
 
-		var updatedProblem ProblemPutDTO
-		err = c.Bind(&updatedProblem)
-		if err != nil {
-			c.String(http.StatusBadRequest, fmt.Sprintf("update problem err: %s", err.Error()))
+		db.Where(&UserTable{Username: c.Param("username")}).Find(&user)
+		if user.Id == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not exist"})
 			return
 		}
-
-		// record new testcases
-		newTestcasesMap := map[string]TestCasePutDTO{}
-		for _, t := range updatedProblem.TestCases {
-			if t.Id != "" {
-				newTestcasesMap[t.Id] = t
-			}
+		if currentUserId, _ := getCurrentUserId(c); currentUserId == user.Id && userDisableDTO.Disabled {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "can't disable yourself"})
+			return
 		}
 
-		db.Transaction(func(tx *gorm.DB) error {
-			// update Problem details
-			result := tx.Model(&ProblemTable{Id: problemId}).Updates(
-				ProblemTable{Title: updatedProblem.Title, Description: updatedProblem.Description})
-			if result.RowsAffected == 0 {
-				fmt.Println("no corresponding row found")
-				return err
-			}
-
-			rows, err := tx.Model(&TestCaseTable{ProblemId: problemId}).Rows()
-			defer rows.Close()
-			if err != nil {
+		if err := db.Model(&user).Update("disabled", userDisableDTO.Disabled).Error; err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+			return
+		}
+		if userDisableDTO.Disabled {
+			if err := sessionStore.DeleteAll(c.Request.Context(), user.Id, ""); err != nil {
 				fmt.Println(err)
-				return err
 			}
+		}
 
-			// delete cur testcase
-			var deletedTestcases []TestCasePutDTO
-			for rows.Next() {
-				var testcase TestCaseTable
-				tx.ScanRows(rows, &testcase)
-
-				_, ok := newTestcasesMap[strconv.Itoa(testcase.Id)]
-				temp := TestCasePutDTO{
-					Id: strconv.Itoa(testcase.Id),
-				}
-
-				if !ok {
-					deletedTestcases = append(deletedTestcases, temp)
-				}
-			}
-			for _, deletedTestcase := range deletedTestcases {
-				deletedId, err := strconv.Atoi(deletedTestcase.Id)
-				if err != nil {
-					fmt.Println("delete error")
-					return err
-				}
+		c.JSON(http.StatusOK, gin.H{
+			"data": newUserAccount(user, getUserRoleNames(db, user.Id)),
+		})
+	}
 
-				tx.Delete(&TestCaseTable{Id: deletedId})
-			}
+	resetUserPasswordHandler := func(c *gin.Context) {
+		var userPasswordDTO UserPasswordPutDTO
+		var user UserTable
 
-			// create & update cur testcase
-			for _, t := range updatedProblem.TestCases {
-				if t.Id == "" {
-					testcase := TestCaseTable{
-						Input:          t.Input,
-						ExpectedOutput: t.ExpectedOutput,
-						Comment:        t.Comment,
-						Score:          t.Score,
-						TimeOutSeconds: t.TimeOutSeconds,
-						ProblemId:      problemId,
-					}
+		err := c.Bind(&userPasswordDTO)
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("reset password err: %s", err.Error()))
+			return
+		}
 
-					tx.Create(&testcase)
-				} else {
-					updatedId, err := strconv.Atoi(t.Id)
-					if err != nil {
-						fmt.Println("update error")
-						return err
-					}
+		db.Where(&UserTable{Username: c.Param("username")}).Find(&user)
+		if user.Id == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not exist"})
+			return
+		}
 
-					tx.Model(&TestCaseTable{Id: updatedId}).Updates(
-						TestCaseTable{
-							Input:          t.Input,
-							ExpectedOutput: t.ExpectedOutput,
-							Comment:        t.Comment,
-							Score:          t.Score,
-							TimeOutSeconds: t.TimeOutSeconds,
-						})
-				}
+		password := userPasswordDTO.Password
+		generated := password == ""
+		if message := validatePassword(password, user.Username); !generated && message != "" {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error":  "invalid password",
+				"fields": []FieldError{{Field: "password", Error: message}},
+			})
+			return
+		}
+		if generated {
+			password, err = randomHex(8)
+			if err != nil {
+				fmt.Println(err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate password"})
+				return
 			}
+		}
 
-			return nil
-		})
+		hashedPassword, err := hashPassword(password)
+		if err == nil {
+			err = db.Model(&user).Update("password", hashedPassword).Error
+		}
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+			return
+		}
+		if err := sessionStore.DeleteAll(c.Request.Context(), user.Id, ""); err != nil {
+			fmt.Println(err)
+		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"Ok": true,
-		})
+		response := gin.H{"Ok": true}
+		if generated {
+			response["password"] = password
+		}
+		c.JSON(http.StatusOK, response)
 	}
 
-	deleteProblemByIDHandler := func(c *gin.Context) {
-		problemId, err := strconv.Atoi(c.Param("id"))
+	getLoginLockoutsHandler := func(c *gin.Context) {
+		lockouts, err := loginThrottle.Lockouts(c.Request.Context())
 		if err != nil {
-			c.String(http.StatusBadRequest, fmt.Sprintf("get problem Id err: %s", err.Error()))
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load lockouts"})
 			return
 		}
 
-		db.Transaction(func(tx *gorm.DB) error {
-			tx.Where("problem_id = ?", problemId).Delete(&TestCaseTable{})
-			tx.Delete(&ProblemTable{}, problemId)
-
-			return nil
+		c.JSON(http.StatusOK, gin.H{
+			"data": lockouts,
 		})
+	}
+
+	clearLoginLockoutHandler := func(c *gin.Context) {
+		kind := c.Param("kind")
+		if kind != LOCKOUT_USER && kind != LOCKOUT_IP {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid lockout kind: %s", kind)})
+			return
+		}
+
+		if err := loginThrottle.Clear(c.Request.Context(), kind, c.Param("key")); err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear lockout"})
+			return
+		}
 
 		c.JSON(http.StatusOK, gin.H{
 			"Ok": true,
 		})
 	}
 
-	problems := r.Group("/problems")
-	{
-		problems.GET("/", getProblemsHandler)
-		problems.GET("/:id", getProblemByIDHandler)
-	}
-	problems.Use(authorizeSuperUser)
-	{
-		problems.POST("/", createProblemHandler)
-		problems.PUT("/:id", updateProblemByIDHandler)
-		problems.DELETE("/:id", deleteProblemByIDHandler)
+	// group: two-factor authentication
+	getTwoFactorHandler := func(c *gin.Context) {
+		userId, _ := getCurrentUserId(c)
+
+		var recoveryCodesLeft int64
+		_, enabled := getEnabledTotp(db, userId)
+		db.Model(&RecoveryCodeTable{}).Where(&RecoveryCodeTable{UserId: userId}).Count(&recoveryCodesLeft)
+
+		c.JSON(http.StatusOK, gin.H{
+			"enabled":           enabled,
+			"setupRequired":     needsTwoFactorSetup(db, userId),
+			"recoveryCodesLeft": recoveryCodesLeft,
+		})
 	}
 
-	createUserHandler := func(c *gin.Context) {
-		var newUserDTO UserPostDTO
-		var newUser UserTable
-		var newUserId int
+	// start enrollment with a fresh secret, 2FA stays off until confirmed
+	setupTwoFactorHandler := func(c *gin.Context) {
+		var user UserTable
+		userId, _ := getCurrentUserId(c)
 
-		err := c.Bind(&newUserDTO)
+		db.Find(&user, userId)
+		if _, ok := getEnabledTotp(db, userId); ok {
+			c.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication is already enabled"})
+			return
+		}
+
+		secret, err := newTotpSecret()
 		if err != nil {
-			c.String(http.StatusBadRequest, fmt.Sprintf("create user err: %s", err.Error()))
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create secret"})
 			return
 		}
-		newUser = UserTable{
-			Username:  newUserDTO.Username,
-			Password:  encryptBySha256(newUserDTO.Password),
-			Name:      newUserDTO.Name,
-			Email:     newUserDTO.Email,
-			Authority: 1,
+		totp := UserTotpTable{UserId: userId, Secret: secret}
+		if err := db.Save(&totp).Error; err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create secret"})
+			return
 		}
 
-		db.Transaction(func(tx *gorm.DB) error {
-			tx.Create(&newUser)
-			newUserId = newUser.Id
+		c.JSON(http.StatusOK, gin.H{
+			"secret":          secret,
+			"provisioningUri": totpProvisioningURI(config.TotpIssuer, user.Username, secret),
+		})
+	}
 
-			return nil
+	// confirm enrollment with a code from the authenticator
+	enableTwoFactorHandler := func(c *gin.Context) {
+		var twoFactorCodeDTO TwoFactorCodeDTO
+		var recoveryCodes []string
+		userId, _ := getCurrentUserId(c)
+
+		err := c.Bind(&twoFactorCodeDTO)
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("enable two-factor err: %s", err.Error()))
+			return
+		}
+
+		matchError := false
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var totp UserTotpTable
+			tx.Where(&UserTotpTable{UserId: userId}).Find(&totp)
+			if totp.UserId == 0 || totp.Enabled {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "no two-factor setup in progress"})
+				matchError = true
+				return nil
+			}
+
+			step, ok := verifyTotp(totp.Secret, strings.TrimSpace(twoFactorCodeDTO.Code), time.Now(), 0)
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid two-factor code"})
+				matchError = true
+				return nil
+			}
+
+			err := tx.Model(&totp).Updates(map[string]interface{}{"enabled": true, "last_used_step": step}).Error
+			if err != nil {
+				return err
+			}
+			recoveryCodes, err = generateRecoveryCodes(tx, userId)
+			return err
 		})
+		if matchError == true {
+			return
+		}
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+			return
+		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"user_id": newUserId,
+			"recoveryCodes": recoveryCodes,
 		})
 	}
 
-	loginHandler := func(c *gin.Context) {
-		var userLoginDTO UserLoginDTO
-		var userId int
-		var authority int
-		session := sessions.Default(c)
+	// needs both the password and a current code
+	disableTwoFactorHandler := func(c *gin.Context) {
+		var twoFactorDisableDTO TwoFactorDisableDTO
+		userId, _ := getCurrentUserId(c)
 
-		err := c.Bind(&userLoginDTO)
+		err := c.Bind(&twoFactorDisableDTO)
 		if err != nil {
-			c.String(http.StatusBadRequest, fmt.Sprintf("login err: %s", err.Error()))
+			c.String(http.StatusBadRequest, fmt.Sprintf("disable two-factor err: %s", err.Error()))
 			return
 		}
 
-		var requesetUser UserTable
-		dbError := false
-		db.Transaction(func(tx *gorm.DB) error {
-			tx.Where(&UserTable{Username: userLoginDTO.Username}).First(&requesetUser)
-			if requesetUser.Id == 0 {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "user not exist"})
-				dbError = true
+		matchError := false
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var user UserTable
+			tx.Find(&user, userId)
+			totp, enabled := getEnabledTotp(tx, userId)
+			if !enabled {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "two-factor authentication is not enabled"})
+				matchError = true
 				return nil
 			}
 
-			if !verifyPassword(userLoginDTO.Password, requesetUser.Password) {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "user's password doesn't match"})
-				dbError = true
+			passwordOk, _ := verifyPassword(twoFactorDisableDTO.Password, user.Password)
+			if !passwordOk || !verifySecondFactor(tx, totp, twoFactorDisableDTO.Code) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid password or two-factor code"})
+				matchError = true
 				return nil
 			}
 
-			userId = requesetUser.Id
-			authority = requesetUser.Authority
-			return nil
+			if err := tx.Where(&RecoveryCodeTable{UserId: userId}).Delete(&RecoveryCodeTable{}).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&totp).Error
 		})
-		if dbError == true {
+		if matchError == true {
+			return
+		}
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
 			return
 		}
 
-		curUser := UserIdAuthorityPrincipal{
-			UserId:    strconv.Itoa(userId),
-			Authority: strconv.Itoa(authority),
+		c.JSON(http.StatusOK, gin.H{
+			"Ok": true,
+		})
+	}
+
+	regenerateRecoveryCodesHandler := func(c *gin.Context) {
+		var twoFactorCodeDTO TwoFactorCodeDTO
+		var recoveryCodes []string
+		userId, _ := getCurrentUserId(c)
+
+		err := c.Bind(&twoFactorCodeDTO)
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("regenerate recovery codes err: %s", err.Error()))
+			return
 		}
-		session.Set(userKey, curUser)
-		if err := session.Save(); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save session"})
+
+		matchError := false
+		err = db.Transaction(func(tx *gorm.DB) error {
+			totp, enabled := getEnabledTotp(tx, userId)
+			if !enabled || !verifySecondFactor(tx, totp, twoFactorCodeDTO.Code) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid two-factor code"})
+				matchError = true
+				return nil
+			}
+
+			recoveryCodes, err = generateRecoveryCodes(tx, userId)
+			return err
+		})
+		if matchError == true {
+			return
+		}
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
 			return
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"user_id":        userId,
-			"user_authority": authority,
+			"recoveryCodes": recoveryCodes,
 		})
 	}
 
-	logoutHandler := func(c *gin.Context) {
-		session := sessions.Default(c)
-		user := session.Get(userKey)
-		if user == nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session token"})
+	// group: profiles
+	getUserProfileHandler := func(c *gin.Context) {
+		var user UserTable
+		db.Where(&UserTable{Username: c.Param("username")}).Find(&user)
+		if user.Id == 0 || user.Disabled {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not exist"})
 			return
 		}
 
-		session.Delete(userKey)
-		if err := session.Save(); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save session"})
+		// the user and user managers see past the privacy settings
+		currentUserId, _ := getCurrentUserId(c)
+		privileged := currentUserId == user.Id || hasPermission(c, PERMISSION_MANAGE_USERS)
+
+		profile := UserProfile{
+			Username: user.Username,
+			Name:     user.Name,
+			JoinedAt: user.CreatedAt,
+		}
+		if user.EmailPublic || privileged {
+			profile.Email = user.Email
+		}
+
+		profile.ActivityHidden = !user.ActivityPublic && !privileged
+		if !profile.ActivityHidden {
+			err := computeUserActivity(db, &profile, user.Id, canManageProblems(c), time.Now())
+			if err != nil {
+				fmt.Println(err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load profile"})
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data": profile,
+		})
+	}
+
+	getPrivacyHandler := func(c *gin.Context) {
+		var user UserTable
+		userId, _ := getCurrentUserId(c)
+		db.Find(&user, userId)
+
+		c.JSON(http.StatusOK, gin.H{
+			"data": UserPrivacy{EmailPublic: user.EmailPublic, ActivityPublic: user.ActivityPublic},
+		})
+	}
+
+	putPrivacyHandler := func(c *gin.Context) {
+		var userPrivacy UserPrivacy
+		userId, _ := getCurrentUserId(c)
+
+		err := c.Bind(&userPrivacy)
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("put privacy err: %s", err.Error()))
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"message": "Successfully logged out"})
+		err = db.Model(&UserTable{Id: userId}).Updates(map[string]interface{}{
+			"email_public":    userPrivacy.EmailPublic,
+			"activity_public": userPrivacy.ActivityPublic,
+		}).Error
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save privacy settings"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data": userPrivacy,
+		})
 	}
 
 	users := r.Group("/users")
@@ -491,6 +4286,40 @@ func main() {
 		users.POST("/", createUserHandler)
 		users.POST("/login", loginHandler)
 		users.POST("/logout", logoutHandler)
+
+		users.POST("/email/verification", authorizeSessionUser, resendEmailVerificationHandler)
+		users.POST("/email/verify", verifyEmailHandler)
+		users.POST("/password/forgot", forgotPasswordHandler)
+		users.POST("/password/reset", resetPasswordHandler)
+
+		users.GET("/sessions", authorizeSessionUser, getSessionsHandler)
+		users.DELETE("/sessions", authorizeSessionUser, deleteOtherSessionsHandler)
+		users.DELETE("/sessions/:sessionId", authorizeSessionUser, deleteSessionHandler)
+		users.GET("/", authorizePermission(PERMISSION_MANAGE_USERS), getUsersHandler)
+		users.GET("/lockouts", authorizePermission(PERMISSION_MANAGE_USERS), getLoginLockoutsHandler)
+		users.DELETE("/lockouts/:kind/:key", authorizePermission(PERMISSION_MANAGE_USERS), clearLoginLockoutHandler)
+		users.GET("/:username/account", authorizePermission(PERMISSION_MANAGE_USERS), getUserAccountHandler)
+		users.PUT("/:username/disable", authorizePermission(PERMISSION_MANAGE_USERS), disableUserHandler)
+		users.PUT("/:username/password", authorizePermission(PERMISSION_MANAGE_USERS), resetUserPasswordHandler)
+		users.DELETE("/:username/sessions", authorizePermission(PERMISSION_MANAGE_USERS), forceLogoutUserHandler)
+
+		users.GET("/:username/roles", authorizePermission(PERMISSION_MANAGE_USERS), getUserRolesHandler)
+		users.PUT("/:username/roles/:role", authorizePermission(PERMISSION_MANAGE_USERS), assignUserRoleHandler)
+		users.DELETE("/:username/roles/:role", authorizePermission(PERMISSION_MANAGE_USERS), removeUserRoleHandler)
+
+		users.GET("/privacy", authorizeNormalUser, getPrivacyHandler)
+		users.PUT("/privacy", authorizeSessionUser, putPrivacyHandler)
+		users.GET("/:username", getUserProfileHandler)
+
+		users.GET("/2fa", authorizeSessionUser, getTwoFactorHandler)
+		users.POST("/2fa/setup", authorizeSessionUser, setupTwoFactorHandler)
+		users.POST("/2fa/enable", authorizeSessionUser, enableTwoFactorHandler)
+		users.POST("/2fa/disable", authorizeSessionUser, disableTwoFactorHandler)
+		users.POST("/2fa/recovery-codes", authorizeSessionUser, regenerateRecoveryCodesHandler)
+
+		users.GET("/tokens", authorizeSessionUser, getApiTokensHandler)
+		users.POST("/tokens", authorizeSessionUser, createApiTokenHandler)
+		users.DELETE("/tokens/:tokenId", authorizeSessionUser, deleteApiTokenHandler)
 	}
 
 	createSubmissionHandler := func(c *gin.Context) {
@@ -499,20 +4328,39 @@ func main() {
 		var newSubmissionId int
 		var testCaseData []JudgerTestCaseData = nil
 
-		session := sessions.Default(c)
-		user := session.Get(userKey)
+		user, _ := getCurrentUser(c)
 
-		userId, err := strconv.Atoi(user.(UserIdAuthorityPrincipal).UserId)
+		userId, err := strconv.Atoi(user.UserId)
 		if err != nil {
 			c.String(http.StatusBadRequest, fmt.Sprintf("get user Id err: %s", err.Error()))
 			return
 		}
 
+		// don't read oversized bodies into memory before rejecting them
+		if config.MaxSourceKB > 0 {
+			bodyLimit := int64(config.MaxSourceKB*1024*6 + SUBMISSION_BODY_OVERHEAD)
+			body, err := io.ReadAll(io.LimitReader(c.Request.Body, bodyLimit+1))
+			if err != nil {
+				c.String(http.StatusBadRequest, fmt.Sprintf("read submission err: %s", err.Error()))
+				return
+			}
+			if int64(len(body)) > bodyLimit {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "source code exceeds the size limit", "maxSourceKB": config.MaxSourceKB})
+				return
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
 		err = c.Bind(&newSubmissionDTO)
 		if err != nil {
 			c.String(http.StatusBadRequest, fmt.Sprintf("create submission err: %s", err.Error()))
 			return
 		}
+		if config.MaxSourceKB > 0 && len(newSubmissionDTO.Code) > config.MaxSourceKB*1024 {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "source code exceeds the size limit", "maxSourceKB": config.MaxSourceKB})
+			return
+		}
+
 		newSubmission = SubmissionTable{
 			Language:     newSubmissionDTO.Language,
 			Code:         newSubmissionDTO.Code,
@@ -523,127 +4371,358 @@ func main() {
 			UserId:    userId,
 		}
 
-		db.Transaction(func(tx *gorm.DB) error {
-			tx.Create(&newSubmission)
-			newSubmissionId = newSubmission.Id
+		matchError := false
+		var problem ProblemTable
+		err = db.Transaction(func(tx *gorm.DB) error {
+			// admins and collaborators may submit to unpublished problems to test them
+			tx.First(&problem, newSubmissionDTO.ProblemId)
+			if problem.Id == 0 {
+				c.JSON(http.StatusNotFound, gin.H{"error": "problem not found"})
+				matchError = true
+				return nil
+			}
+			if !isProblemOpenForSubmission(problem, time.Now()) &&
+				!hasProblemRole(c, tx, problem.Id, PROBLEM_ROLE_VIEWER) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "problem is not open for submission"})
+				matchError = true
+				return nil
+			}
+
+			var problemLanguages []ProblemLanguageTable
+			tx.Where("problem_id = ?", newSubmissionDTO.ProblemId).Find(&problemLanguages)
+			timeMultiplier, ok := findTimeMultiplier(problemLanguages, newSubmissionDTO.Language)
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "language is not allowed for this problem"})
+				matchError = true
+				return nil
+			}
+
+			if problem.SourceLimitKB > 0 && len(newSubmissionDTO.Code) > problem.SourceLimitKB*1024 {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "source code exceeds the size limit"})
+				matchError = true
+				return nil
+			}
+
+			// only valid submissions use up the user's quota
+			if !checkSubmissionLimits(c, tx, submissionLimiter, config.MaxPendingSubmissions, userId) {
+				matchError = true
+				return nil
+			}
 
 			rows, err := tx.Model(&TestCaseTable{}).Where("problem_id = ?", newSubmissionDTO.ProblemId).Rows()
-			defer rows.Close()
 			if err != nil {
 				fmt.Println(err)
 				return err
 			}
+			defer rows.Close()
 
 			for rows.Next() {
 				var testcase TestCaseTable
 				tx.ScanRows(rows, &testcase)
 
-				temp := JudgerTestCaseData{
-					Input:          testcase.Input,
-					ExpectedOutput: testcase.ExpectedOutput,
-					Score:          testcase.Score,
-					TimeOutSeconds: testcase.TimeOutSeconds,
+				testCaseData = append(testCaseData, newJudgerTestCaseData(testcase, problem, timeMultiplier))
+			}
+
+			// nothing to judge against, don't leave the submission pending forever
+			if testCaseData == nil {
+				newSubmission.Result = SUBMISSION_NOT_JUDGEABLE
+			} else if newSubmission.RunId, err = newJudgeRunId(); err != nil {
+				return err
+			}
+
+			if err := tx.Create(&newSubmission).Error; err != nil {
+				fmt.Println(err)
+				return err
+			}
+			newSubmissionId = newSubmission.Id
+
+			return nil
+		})
+		if matchError {
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if newSubmissionId != 0 && testCaseData != nil {
+			if err = getConnection(rdb); err == nil {
+				judgerSubmissionData := newJudgerSubmissionData(newSubmission, problem, testCaseData)
+				// the submission stays pending and is pushed again by a bulk restart
+				if err := pushJudgerSubmissionData(rdb, judgerSubmissionData); err != nil {
+					fmt.Println(err)
 				}
+			} else {
+				fmt.Println(err)
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"submission_id": newSubmissionId,
+			"result":        newSubmission.Result,
+		})
+	}
+
+	getSubmissionByIDHandler := func(c *gin.Context) {
+		submissionId, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get submission Id err: %s", err.Error()))
+			return
+		}
+
+		var responseData Submission
+		var requesetSubmission SubmissionTable
+		matchError := false
+		db.Transaction(func(tx *gorm.DB) error {
+			tx.First(&requesetSubmission, submissionId)
+			if requesetSubmission.Id == 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "submissionId not match"})
+				matchError = true
+				return nil
+			}
+
+			if !canAccessSubmission(c, requesetSubmission, PERMISSION_VIEW_ALL_SUBMISSIONS) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "user not match"})
+				matchError = true
+				return nil
+			}
+
+			// deleted problems are still resolvable for their submission history
+			var problem ProblemTable
+			tx.Unscoped().First(&problem, requesetSubmission.ProblemId)
+
+			responseData = newSubmission(requesetSubmission, problem)
+
+			return nil
+		})
+
+		if matchError {
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data": responseData,
+		})
+	}
+
+	// only submissions still waiting for a verdict can be cancelled
+	cancelSubmissionHandler := func(c *gin.Context) {
+		submissionId, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get submission Id err: %s", err.Error()))
+			return
+		}
+
+		var submission SubmissionTable
+		matchError := false
+		err = db.Transaction(func(tx *gorm.DB) error {
+			tx.First(&submission, submissionId)
+			if submission.Id == 0 {
+				c.JSON(http.StatusNotFound, gin.H{"error": "submission not found"})
+				matchError = true
+				return nil
+			}
 
-				testCaseData = append(testCaseData, temp)
+			if !canAccessSubmission(c, submission, PERMISSION_REJUDGE) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "user not match"})
+				matchError = true
+				return nil
 			}
 
+			// the judger may report a verdict at the same time
+			result := tx.Model(&submission).Where("result = ?", SUBMISSION_NO_RESULT).
+				Update("result", SUBMISSION_CANCELLED)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				c.JSON(http.StatusConflict, gin.H{"error": "submission is not pending", "result": submission.Result})
+				matchError = true
+			}
 			return nil
 		})
+		if matchError {
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
 
-		if newSubmissionId != 0 && testCaseData != nil {
-			if err = getConnection(rdb); err == nil {
-				judgerSubmissionData := JudgerSubmissionData{
-					Id:        newSubmissionId,
-					Language:  newSubmission.Language,
-					Code:      newSubmission.Code,
-					TestCases: testCaseData,
-				}
-
-				// todo: check correctness
-				bytes, err := json.Marshal(judgerSubmissionData)
-				if err != nil {
-					panic(err)
-				}
-
-				ctx := context.Background()
-				_, err = rdb.RPush(ctx, newSubmission.Language, bytes).Result()
-				if err != nil {
-					panic(err)
-				}
-			} else {
+		// the submission is cancelled either way, a judger that still runs it
+		// has its verdict dropped
+		dequeued := false
+		if err = getConnection(rdb); err == nil {
+			ctx := context.Background()
+			if dequeued, err = cancelJudgerSubmission(ctx, rdb, submission); err != nil {
+				fmt.Println(err)
+			}
+			if err := rdb.Del(ctx, problemStatsKey(submission.ProblemId)).Err(); err != nil {
 				fmt.Println(err)
 			}
+		} else {
+			fmt.Println(err)
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"submission_id": newSubmissionId,
+			"data":     true,
+			"dequeued": dequeued,
 		})
 	}
 
-	getSubmissionByIDHandler := func(c *gin.Context) {
+	unshareSubmissionHandler := func(c *gin.Context) {
 		submissionId, err := strconv.Atoi(c.Param("id"))
 		if err != nil {
 			c.String(http.StatusBadRequest, fmt.Sprintf("get submission Id err: %s", err.Error()))
 			return
 		}
 
-		session := sessions.Default(c)
-		user := session.Get(userKey)
+		userId, _ := getCurrentUserId(c)
+		result := db.Model(&SubmissionTable{}).Where("id = ? AND user_id = ?", submissionId, userId).
+			Update("share_token_hash", "")
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "submission not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data": true,
+		})
+	}
+
+	// own submissions, users who view all submissions see everyone's and may
+	// narrow it down with ?username=
+	getSubmissionsHandler := func(c *gin.Context) {
+		var submissionTables []SubmissionTable
+		var total int64
+		submissions := []SubmissionSummary{}
 
-		userId, err := strconv.Atoi(user.(UserIdAuthorityPrincipal).UserId)
+		page, pageSize, err := getPagination(c)
 		if err != nil {
-			c.String(http.StatusBadRequest, fmt.Sprintf("get user Id err: %s", err.Error()))
+			c.String(http.StatusBadRequest, fmt.Sprintf("get pagination err: %s", err.Error()))
 			return
 		}
 
-		var responseData Submission
-		var requesetSubmission SubmissionTable
-		matchError := false
-		db.Transaction(func(tx *gorm.DB) error {
-			tx.First(&requesetSubmission, submissionId)
-			if requesetSubmission.Id == 0 {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "submissionId not match"})
-				matchError = true
-				return nil
-			}
+		sortColumn, ok := submissionSortColumns[c.DefaultQuery("sort", "id")]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid sort: %s", c.Query("sort"))})
+			return
+		}
+		order := c.DefaultQuery("order", "desc")
+		if order != "asc" && order != "desc" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid order: %s", order)})
+			return
+		}
 
-			if requesetSubmission.UserId != userId {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "user not match"})
-				matchError = true
-				return nil
-			}
+		viewAll := hasPermission(c, PERMISSION_VIEW_ALL_SUBMISSIONS) && hasScope(c, SCOPE_PROBLEMS_ADMIN)
+		username := c.Query("username")
+		if username != "" && !viewAll {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		// validation runs of reference solutions aren't listed
+		query := db.Model(&SubmissionTable{}).Where("reference_solution_id = 0")
+		if !viewAll {
+			userId, _ := getCurrentUserId(c)
+			query = query.Where("user_id = ?", userId)
+		} else if username != "" {
+			query = query.Where("user_id IN (?)", db.Model(&UserTable{}).Select("id").Where("username = ?", username))
+		}
 
-			responseData = Submission{
-				Id:           requesetSubmission.Id,
-				Language:     requesetSubmission.Language,
-				Code:         requesetSubmission.Code,
-				ExecutedTime: requesetSubmission.ExecutedTime,
-				Result:       requesetSubmission.Result,
-				ProblemId:    requesetSubmission.ProblemId,
-				UserId:       requesetSubmission.UserId,
+		if problemId := c.Query("problemId"); problemId != "" {
+			id, err := strconv.Atoi(problemId)
+			if err != nil {
+				c.String(http.StatusBadRequest, fmt.Sprintf("get problem Id err: %s", err.Error()))
+				return
+			}
+			query = query.Where("problem_id = ?", id)
+		}
+		if language := c.Query("language"); language != "" {
+			query = query.Where("language = ?", language)
+		}
+		if verdict := c.Query("verdict"); verdict != "" {
+			query = query.Where("result = ?", verdict)
+		}
+		if from := c.Query("from"); from != "" {
+			fromTime, err := parseTimeQuery(from, false)
+			if err != nil {
+				c.String(http.StatusBadRequest, fmt.Sprintf("get from err: %s", err.Error()))
+				return
+			}
+			query = query.Where("created_at >= ?", fromTime)
+		}
+		if to := c.Query("to"); to != "" {
+			toTime, err := parseTimeQuery(to, true)
+			if err != nil {
+				c.String(http.StatusBadRequest, fmt.Sprintf("get to err: %s", err.Error()))
+				return
 			}
+			query = query.Where("created_at < ?", toTime)
+		}
 
-			return nil
-		})
+		query.Count(&total)
+		query.Order(sortColumn + " " + order).Order("id " + order).
+			Offset((page - 1) * pageSize).Limit(pageSize).Find(&submissionTables)
 
-		if matchError {
-			return
+		var problemIds, userIds []int
+		for _, submission := range submissionTables {
+			problemIds = append(problemIds, submission.ProblemId)
+			userIds = append(userIds, submission.UserId)
+		}
+
+		// deleted problems are still resolvable for their submission history
+		var problems []ProblemTable
+		db.Unscoped().Select("id, title").Where("id IN ?", problemIds).Find(&problems)
+		problemTitles := make(map[int]string)
+		for _, problem := range problems {
+			problemTitles[problem.Id] = problem.Title
+		}
+		var users []UserTable
+		db.Select("id, username").Where("id IN ?", userIds).Find(&users)
+		usernames := make(map[int]string)
+		for _, user := range users {
+			usernames[user.Id] = user.Username
+		}
+
+		for _, submission := range submissionTables {
+			submissions = append(submissions, SubmissionSummary{
+				Id:           submission.Id,
+				Language:     submission.Language,
+				ExecutedTime: submission.ExecutedTime,
+				Result:       submission.Result,
+				ProblemId:    submission.ProblemId,
+				ProblemTitle: problemTitles[submission.ProblemId],
+				UserId:       submission.UserId,
+				Username:     usernames[submission.UserId],
+				CreatedAt:    submission.CreatedAt,
+			})
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"data": responseData,
+			"data":     submissions,
+			"total":    total,
+			"page":     page,
+			"pageSize": pageSize,
 		})
 	}
 
 	restartSubmissionsHandler := func(c *gin.Context) {
 		var unjudgedSubmissionDataList []JudgerSubmissionData = nil
+		var unjudgeableSubmissionIds []int
 		var problem_ids []int
-		judgerTestCasesMap := make(map[int][]JudgerTestCaseData)
+		testCasesMap := make(map[int][]TestCaseTable)
 		submissionsMap := make(map[int][]SubmissionTable)
+		problemsMap := make(map[int]ProblemTable)
+		problemLanguagesMap := make(map[int][]ProblemLanguageTable)
 		isOK := true
 
-		db.Transaction(func(tx *gorm.DB) error {
+		err := db.Transaction(func(tx *gorm.DB) error {
 			// 1. find all unjudged submissoins and its problemId
 			rows, err := tx.Model(&SubmissionTable{}).Where("result = ?", SUBMISSION_NO_RESULT).Rows()
 			defer rows.Close()
@@ -658,7 +4737,20 @@ func main() {
 				problem_ids = append(problem_ids, submission.ProblemId)
 				submissionsMap[submission.ProblemId] = append(submissionsMap[submission.ProblemId], submission)
 			}
-			// 2. find it's related testCases
+			// 2. find it's related problems, languages and testCases,
+			// trashed problems still carry the limits to judge with
+			var problems []ProblemTable
+			tx.Unscoped().Where("id IN ?", problem_ids).Find(&problems)
+			for _, problem := range problems {
+				problemsMap[problem.Id] = problem
+			}
+
+			var problemLanguages []ProblemLanguageTable
+			tx.Where("problem_id IN ?", problem_ids).Find(&problemLanguages)
+			for _, l := range problemLanguages {
+				problemLanguagesMap[l.ProblemId] = append(problemLanguagesMap[l.ProblemId], l)
+			}
+
 			rows, err = tx.Model(&TestCaseTable{}).Where("problem_id IN ?", problem_ids).Rows()
 			defer rows.Close()
 			if err != nil {
@@ -669,35 +4761,85 @@ func main() {
 				var testCase TestCaseTable
 				tx.ScanRows(rows, &testCase)
 
-				judgerTestCase := JudgerTestCaseData{
-					Input:          testCase.Input,
-					ExpectedOutput: testCase.ExpectedOutput,
-					Score:          testCase.Score,
-					TimeOutSeconds: testCase.TimeOutSeconds,
-				}
-
-				judgerTestCasesMap[testCase.ProblemId] = append(judgerTestCasesMap[testCase.ProblemId], judgerTestCase)
+				testCasesMap[testCase.ProblemId] = append(testCasesMap[testCase.ProblemId], testCase)
 			}
 
 			return nil
 		})
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load submissions"})
+			return
+		}
 
-		// 3. combine to JudgerSubmissionData and push to Redis
-		for _, submissions := range submissionsMap {
+		// 3. combine to JudgerSubmissionData and push to Redis, every run gets a new
+		// run id so a verdict of the run pushed before is rejected
+		for problemId, submissions := range submissionsMap {
+			problem := problemsMap[problemId]
 			for _, submission := range submissions {
-				judgerSubmissionData := JudgerSubmissionData{
-					Id:        submission.Id,
-					Language:  submission.Language,
-					Code:      submission.Code,
-					TestCases: judgerTestCasesMap[submission.ProblemId],
+				timeMultiplier, ok := findTimeMultiplier(problemLanguagesMap[problemId], submission.Language)
+				if !ok {
+					timeMultiplier = 1
+				}
+
+				var judgerTestCases []JudgerTestCaseData
+				for _, testCase := range testCasesMap[problemId] {
+					judgerTestCases = append(judgerTestCases, newJudgerTestCaseData(testCase, problem, timeMultiplier))
+				}
+				if judgerTestCases == nil {
+					unjudgeableSubmissionIds = append(unjudgeableSubmissionIds, submission.Id)
+					continue
 				}
 
+				runId, err := newJudgeRunId()
+				if err != nil {
+					fmt.Println(err)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue submissions"})
+					return
+				}
+				submission.RunId = runId
+
+				judgerSubmissionData := newJudgerSubmissionData(submission, problem, judgerTestCases)
+
 				unjudgedSubmissionDataList = append(unjudgedSubmissionDataList, judgerSubmissionData)
 			}
 		}
 
-		if unjudgedSubmissionDataList != nil {
+		// the new run ids are stored together, submissions judged in the meantime
+		// aren't pushed again
+		var queuedSubmissionDataList []JudgerSubmissionData
+		err = db.Transaction(func(tx *gorm.DB) error {
+			// nothing to judge against, these are never pushed
+			if unjudgeableSubmissionIds != nil {
+				err := tx.Model(&SubmissionTable{}).
+					Where("id IN ? AND result = ?", unjudgeableSubmissionIds, SUBMISSION_NO_RESULT).
+					Update("result", SUBMISSION_NOT_JUDGEABLE).Error
+				if err != nil {
+					return err
+				}
+			}
+
 			for _, unjudgedSubmissionData := range unjudgedSubmissionDataList {
+				result := tx.Model(&SubmissionTable{}).
+					Where("id = ? AND result = ?", unjudgedSubmissionData.Id, SUBMISSION_NO_RESULT).
+					Update("run_id", unjudgedSubmissionData.RunId)
+				if result.Error != nil {
+					return result.Error
+				}
+				if result.RowsAffected > 0 {
+					queuedSubmissionDataList = append(queuedSubmissionDataList, unjudgedSubmissionData)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue submissions"})
+			return
+		}
+
+		if queuedSubmissionDataList != nil {
+			for _, unjudgedSubmissionData := range queuedSubmissionDataList {
 				if err = getConnection(rdb); err != nil {
 					isOK = false
 					c.JSON(http.StatusInternalServerError, gin.H{
@@ -706,15 +4848,10 @@ func main() {
 					return
 				}
 
-				bytes, err := json.Marshal(unjudgedSubmissionData)
-				if err != nil {
-					panic(err)
-				}
-
-				ctx := context.Background()
-				_, err = rdb.RPush(ctx, unjudgedSubmissionData.Language, bytes).Result()
-				if err != nil {
-					panic(err)
+				if err := pushJudgerSubmissionData(rdb, unjudgedSubmissionData); err != nil {
+					fmt.Println(err)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue submissions"})
+					return
 				}
 			}
 		}
@@ -731,21 +4868,13 @@ func main() {
 			return
 		}
 
-		session := sessions.Default(c)
-		user := session.Get(userKey)
-
-		userId, err := strconv.Atoi(user.(UserIdAuthorityPrincipal).UserId)
-		if err != nil {
-			c.String(http.StatusBadRequest, fmt.Sprintf("get user Id err: %s", err.Error()))
-			return
-		}
-
 		var requesetSubmission SubmissionTable
+		var problem ProblemTable
 		var judgerTestCases []JudgerTestCaseData
 		matchError := false
 		isOK := true
 
-		db.Transaction(func(tx *gorm.DB) error {
+		err = db.Transaction(func(tx *gorm.DB) error {
 			// 1. check submission id exist or not
 			tx.First(&requesetSubmission, submissionId)
 			if requesetSubmission.Id == 0 {
@@ -754,14 +4883,24 @@ func main() {
 				return nil
 			}
 
-			// 2. check submission.user is cur user or not
-			if requesetSubmission.UserId != userId {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "user not match"})
+			// 2. check submission.user is cur user or may rejudge any submission
+			if !canAccessSubmission(c, requesetSubmission, PERMISSION_REJUDGE) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "user not match"})
 				matchError = true
 				return nil
 			}
 
-			// 3. find submission related testCases
+			// 3. find submission related problem and testCases, trashed problems
+			// still carry the limits to judge with
+			tx.Unscoped().First(&problem, requesetSubmission.ProblemId)
+
+			var problemLanguages []ProblemLanguageTable
+			tx.Where("problem_id = ?", requesetSubmission.ProblemId).Find(&problemLanguages)
+			timeMultiplier, ok := findTimeMultiplier(problemLanguages, requesetSubmission.Language)
+			if !ok {
+				timeMultiplier = 1
+			}
+
 			rows, err := tx.Model(&TestCaseTable{}).Where("problem_id = ?", requesetSubmission.ProblemId).Rows()
 			defer rows.Close()
 			if err != nil {
@@ -772,22 +4911,56 @@ func main() {
 				var testCase TestCaseTable
 				tx.ScanRows(rows, &testCase)
 
-				judgerTestCase := JudgerTestCaseData{
-					Input:          testCase.Input,
-					ExpectedOutput: testCase.ExpectedOutput,
-					Score:          testCase.Score,
-					TimeOutSeconds: testCase.TimeOutSeconds,
+				judgerTestCases = append(judgerTestCases, newJudgerTestCaseData(testCase, problem, timeMultiplier))
+			}
+
+			// nothing to judge against, a pending submission would wait forever
+			// while a judged or cancelled one keeps its result
+			if judgerTestCases == nil {
+				result := requesetSubmission.Result
+				if result == SUBMISSION_NO_RESULT {
+					if err := tx.Model(&requesetSubmission).Update("result", SUBMISSION_NOT_JUDGEABLE).Error; err != nil {
+						return err
+					}
+					result = SUBMISSION_NOT_JUDGEABLE
 				}
+				c.JSON(http.StatusConflict, gin.H{"error": "problem has no testcases", "result": result})
+				matchError = true
+				return nil
+			}
 
-				judgerTestCases = append(judgerTestCases, judgerTestCase)
+			// owners restarting their own submissions use up their quota like new
+			// submissions do
+			if !(hasPermission(c, PERMISSION_REJUDGE) && hasScope(c, SCOPE_PROBLEMS_ADMIN)) &&
+				!checkSubmissionLimits(c, tx, submissionLimiter, config.MaxPendingSubmissions, requesetSubmission.UserId) {
+				matchError = true
+				return nil
 			}
 
+			// a new run id drops the verdict of a run still in flight, a cancelled
+			// submission is judged again from scratch
+			runId, err := newJudgeRunId()
+			if err != nil {
+				return err
+			}
+			updates := map[string]interface{}{"run_id": runId}
+			if requesetSubmission.Result == SUBMISSION_CANCELLED {
+				updates["result"] = SUBMISSION_NO_RESULT
+			}
+			if err := tx.Model(&requesetSubmission).Updates(updates).Error; err != nil {
+				return err
+			}
+			requesetSubmission.RunId = runId
 			return nil
 		})
 
 		if matchError {
 			return
 		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
 
 		// 4. combine submission and testCases to JudgerSubmissionData, push JudgerSubmissionData to Redis
 		if err = getConnection(rdb); err != nil {
@@ -798,39 +4971,228 @@ func main() {
 			return
 		}
 
-		// todo: check correctness
-		unjudgedSubmissionData := JudgerSubmissionData{
-			Id:        requesetSubmission.Id,
-			Language:  requesetSubmission.Language,
-			Code:      requesetSubmission.Code,
-			TestCases: judgerTestCases,
+		unjudgedSubmissionData := newJudgerSubmissionData(requesetSubmission, problem, judgerTestCases)
+		if err := pushJudgerSubmissionData(rdb, unjudgedSubmissionData); err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue submission"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"data": isOK,
+		})
+	}
+
+	submissions := r.Group("/submissions")
+	submissions.Use(authorizeNormalUser)
+	{
+		submissions.GET("/", requireScope(SCOPE_SUBMISSIONS_READ), getSubmissionsHandler)
+		submissions.POST("/", requireScope(SCOPE_SUBMISSIONS_WRITE), createSubmissionHandler)
+		submissions.GET("/:id", requireScope(SCOPE_SUBMISSIONS_READ), getSubmissionByIDHandler)
+		submissions.POST("/:id/restart", requireScope(SCOPE_SUBMISSIONS_WRITE), restartSubmissionByIDHandler)
+		submissions.POST("/:id/cancel", requireScope(SCOPE_SUBMISSIONS_WRITE), cancelSubmissionHandler)
+		submissions.POST("/:id/share", authorizeSessionUser, shareSubmission(db, config.BaseURL))
+		submissions.DELETE("/:id/share", authorizeSessionUser, unshareSubmissionHandler)
+	}
+	r.GET(SHARED_SUBMISSION_PATH+":token", getSharedSubmission(db))
+	submissions.Use(authorizePermission(PERMISSION_REJUDGE))
+	{
+		submissions.POST("/restart", restartSubmissionsHandler)
+	}
+
+	// group: judger callbacks
+	reportSubmissionResultHandler := func(c *gin.Context) {
+		submissionId, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get submission Id err: %s", err.Error()))
+			return
+		}
+
+		var resultDTO JudgerResultDTO
+		err = c.Bind(&resultDTO)
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("report result err: %s", err.Error()))
+			return
+		}
+		if resultDTO.Result == "" || resultDTO.Result == SUBMISSION_NO_RESULT {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "result is empty"})
+			return
+		}
+
+		var submission SubmissionTable
+		matchError := false
+		err = db.Transaction(func(tx *gorm.DB) error {
+			tx.First(&submission, submissionId)
+			if submission.Id == 0 {
+				c.JSON(http.StatusNotFound, gin.H{"error": "submission not found"})
+				matchError = true
+				return nil
+			}
+
+			// only the current run may report, submissions queued before run ids
+			// have none
+			if resultDTO.RunId != submission.RunId {
+				c.JSON(http.StatusConflict, gin.H{"error": "run is outdated"})
+				matchError = true
+				return nil
+			}
+
+			// a verdict racing a cancel or a restart is dropped
+			result := tx.Model(&submission).Where("result <> ? AND run_id = ?", SUBMISSION_CANCELLED, submission.RunId).
+				Updates(map[string]interface{}{
+					"result":        resultDTO.Result,
+					"executed_time": resultDTO.ExecutedTime,
+				})
+			if result.Error == nil && result.RowsAffected == 0 {
+				c.JSON(http.StatusConflict, gin.H{"error": "submission was cancelled or restarted"})
+				matchError = true
+			}
+			return result.Error
+		})
+		if matchError {
+			return
+		}
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save result"})
+			return
+		}
+
+		// a new verdict invalidates the cached problem stats and may move the
+		// user on the leaderboard, the run is done and can't be cancelled anymore
+		if err = getConnection(rdb); err == nil {
+			ctx := context.Background()
+			if err := rdb.Del(ctx, problemStatsKey(submission.ProblemId), judgeRunPayloadKey(submission.Id, submission.RunId)).Err(); err != nil {
+				fmt.Println(err)
+			}
+		}
+		if submission.ReferenceSolutionId == 0 {
+			leaderboardWorker.Update(submission.UserId)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"Ok": true,
+		})
+	}
+
+	// hand the outputs to the request waiting in runProblemTool
+	reportToolRunResultHandler := func(c *gin.Context) {
+		var resultDTO JudgerToolRunResultDTO
+		err := c.Bind(&resultDTO)
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("report tool run err: %s", err.Error()))
+			return
 		}
-		bytes, err := json.Marshal(unjudgedSubmissionData)
+
+		bytes, err := json.Marshal(resultDTO)
 		if err != nil {
-			panic(err)
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store tool run result"})
+			return
+		}
+
+		if err = getConnection(rdb); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"redis": "disconnection",
+			})
+			return
 		}
 
+		// nobody waits for the result after the timeout, let it expire
 		ctx := context.Background()
-		_, err = rdb.RPush(ctx, unjudgedSubmissionData.Language, bytes).Result()
+		key := toolRunResultKey(c.Param("jobId"))
+		if err := rdb.RPush(ctx, key, bytes).Err(); err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store tool run result"})
+			return
+		}
+		rdb.Expire(ctx, key, config.ToolRunTimeout)
+
+		c.JSON(http.StatusOK, gin.H{
+			"Ok": true,
+		})
+	}
+
+	// group: leaderboard
+	getLeaderboardHandler := func(c *gin.Context) {
+		page, pageSize, err := getPagination(c)
 		if err != nil {
-			panic(err)
+			c.String(http.StatusBadRequest, fmt.Sprintf("get pagination err: %s", err.Error()))
+			return
+		}
+
+		ctx := c.Request.Context()
+		total, err := leaderboard.Count(ctx)
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"redis": "disconnection"})
+			return
+		}
+		entries, err := leaderboard.Page(ctx, (page-1)*pageSize, pageSize)
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"redis": "disconnection"})
+			return
 		}
+		setLeaderboardUsernames(db, entries)
 
 		c.JSON(http.StatusOK, gin.H{
-			"data": isOK,
+			"data":     entries,
+			"total":    total,
+			"page":     page,
+			"pageSize": pageSize,
 		})
 	}
 
-	submissions := r.Group("/submissions")
-	submissions.Use(authorizeNormalUser)
+	getMyLeaderboardRankHandler := func(c *gin.Context) {
+		userId, _ := getCurrentUserId(c)
+
+		entry, ok, err := leaderboard.Entry(c.Request.Context(), userId)
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"redis": "disconnection"})
+			return
+		}
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not ranked yet"})
+			return
+		}
+		entries := []LeaderboardEntry{entry}
+		setLeaderboardUsernames(db, entries)
+
+		// the page the user is on with the requested page size
+		_, pageSize, err := getPagination(c)
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("get pagination err: %s", err.Error()))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"data": entries[0],
+			"page": (entry.Rank-1)/int64(pageSize) + 1,
+		})
+	}
+
+	rebuildLeaderboardHandler := func(c *gin.Context) {
+		// queued behind pending updates, the new ranking shows up once it's done
+		leaderboardWorker.Rebuild()
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"Ok": true,
+		})
+	}
+
+	leaderboards := r.Group("/leaderboard")
 	{
-		submissions.POST("/", createSubmissionHandler)
-		submissions.GET("/:id", getSubmissionByIDHandler)
-		submissions.POST("/:id/restart", restartSubmissionByIDHandler)
+		leaderboards.GET("/", getLeaderboardHandler)
+		leaderboards.GET("/me", authorizeNormalUser, getMyLeaderboardRankHandler)
+		leaderboards.POST("/rebuild", authorizePermission(PERMISSION_MANAGE_PROBLEMS), rebuildLeaderboardHandler)
 	}
-	submissions.Use(authorizeSuperUser)
+
+	judger := r.Group("/judger")
+	judger.Use(authorizeJudger(config.JudgerToken))
 	{
-		submissions.POST("/restart", restartSubmissionsHandler)
+		judger.PUT("/submissions/:id/result", reportSubmissionResultHandler)
+		judger.PUT("/tool-runs/:jobId/result", reportToolRunResultHandler)
 	}
 
 	r.Run() // listen and serve on 0.0.0.0:8080